@@ -1,23 +1,76 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"joiask-backend/internal/config"
 	"joiask-backend/internal/database"
+	"joiask-backend/internal/logging"
 	"joiask-backend/internal/router"
+	"joiask-backend/internal/search"
+	"os"
 
 	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
 func main() {
-	viper.SetConfigFile("./config/config.json")
-	err := viper.ReadInConfig()
+	args := os.Args[1:]
+	if len(args) >= 2 && args[0] == "config" && args[1] == "check" {
+		os.Exit(checkConfig(args[2:]))
+	}
+	flags := flag.NewFlagSet("jask", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: jask [--config path]")
+		fmt.Fprintln(flags.Output(), "       jask config check [--config path]")
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", config.DefaultPath, "path of the config file")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("Failed to load config: ", err)
+	}
+	logging.Init()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid config:\n%v", err)
 	}
 	log.Info("Config loaded")
 	database.Init()
 	log.Info("Database initialized")
+	search.Init()
 	log.Info("Starting server")
 	router.Run()
 }
+
+// checkConfig validates the config and prints it with environment overrides
+// applied and secrets masked, it returns the exit code.
+func checkConfig(args []string) int {
+	flags := flag.NewFlagSet("jask config check", flag.ExitOnError)
+	configPath := flags.String("config", config.DefaultPath, "path of the config file")
+	flags.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load config:", err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config:\n%v\n", err)
+		return 1
+	}
+	b, err := json.MarshalIndent(cfg.Redacted(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(b))
+	fmt.Println("Config is valid")
+	return 0
+}
@@ -1,32 +1,39 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"joiask-backend/internal/config"
 	"joiask-backend/internal/database"
 	"joiask-backend/internal/database/oldmodels"
+	"joiask-backend/internal/logging"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
 // Only use for joi's question box
 func main() {
+	configPath := flag.String("config", config.DefaultPath, "path of the config file")
+	flag.Parse()
 	log.Info("Starting migration")
-	viper.SetConfigFile("./config/config.json")
-	err := viper.ReadInConfig()
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("Failed to load config: ", err)
+	}
+	logging.Init()
+	if cfg.MySQL.Host == "" || cfg.MySQL.User == "" {
+		log.Fatal("Invalid config: mysql.host and mysql.user must be set")
 	}
 	log.Info("Config loaded")
-	v1Dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local", viper.GetString("mysql.user"), viper.GetString("mysql.pass"), viper.GetString("mysql.host"), viper.GetInt("mysql.port"), "jask")
+	v1Dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local", cfg.MySQL.User, cfg.MySQL.Pass, cfg.MySQL.Host, cfg.MySQL.Port, "jask")
 	V1DB, err := gorm.Open(mysql.Open(v1Dsn), &gorm.Config{})
 	if err != nil {
 		log.Fatal(err)
 	}
-	v2Dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local", viper.GetString("mysql.user"), viper.GetString("mysql.pass"), viper.GetString("mysql.host"), viper.GetInt("mysql.port"), "jask_v2")
+	v2Dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local", cfg.MySQL.User, cfg.MySQL.Pass, cfg.MySQL.Host, cfg.MySQL.Port, "jask_v2")
 	V2DB, err := gorm.Open(mysql.Open(v2Dsn), &gorm.Config{})
 	if err != nil {
 		log.Fatal(err)
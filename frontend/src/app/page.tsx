@@ -15,7 +15,7 @@ import { PostCard } from '@/components/post-card';
 import { FileUpload } from '@/components/file-upload';
 import { InputEmojiPicker } from '@/components/input-emoji-picker';
 import { GoToTop } from '@/components/go-to-top';
-import { getQuestions, getTags, getConfig, getInfo, createQuestion, Tag, Question } from '@/lib/api';
+import { getQuestions, getTags, flattenTags, getConfig, getInfo, createQuestion, ChallengeError, Tag, Question } from '@/lib/api';
 import { useWebSocket } from '@/hooks/useWebSocket';
 
 export default function HomePage() {
@@ -32,7 +32,7 @@ export default function HomePage() {
 
   // Questions state
   const [questions, setQuestions] = useState<Question[]>([]);
-  const [page, setPage] = useState(1);
+  const [cursor, setCursor] = useState('');
   const [hasMore, setHasMore] = useState(true);
   const [isLoading, setIsLoading] = useState(false);
   const [hideArchive, setHideArchive] = useState(false);
@@ -51,8 +51,7 @@ export default function HomePage() {
 
     getTags().then((res) => {
       if (res.code === 200 && res.data) {
-        const sorted = [res.data[0], ...res.data.slice(1).reverse()];
-        setTags(sorted);
+        setTags(flattenTags(res.data));
       }
     });
 
@@ -72,10 +71,10 @@ export default function HomePage() {
     if (isLoading) return;
     setIsLoading(true);
 
-    const currentPage = reset ? 1 : page;
+    const currentCursor = reset ? '' : cursor;
     try {
       const res = await getQuestions({
-        page: currentPage,
+        cursor: currentCursor,
         size: 5,
         publish: true,
         order_by: 'id',
@@ -90,15 +89,15 @@ export default function HomePage() {
         } else {
           setQuestions((prev) => [...prev, ...newQuestions]);
         }
-        setHasMore(newQuestions.length >= 5);
-        setPage(currentPage + 1);
+        setHasMore(!!res.data.next_cursor);
+        setCursor(res.data.next_cursor || '');
       }
     } catch (error) {
       console.error('Failed to load questions:', error);
     } finally {
       setIsLoading(false);
     }
-  }, [page, sortOrder, hideArchive, isLoading]);
+  }, [cursor, sortOrder, hideArchive, isLoading]);
 
   // Initial load
   useEffect(() => {
@@ -199,7 +198,7 @@ export default function HomePage() {
       }
     } catch (error) {
       console.error('Submit error:', error);
-      alert('投稿失败');
+      alert(error instanceof ChallengeError ? error.message : '投稿失败');
     } finally {
       setIsSubmitting(false);
     }
@@ -259,7 +258,7 @@ export default function HomePage() {
             maxLength={800}
             value={content}
             onChange={handleContentChange}
-            placeholder="输入你的提问..."
+            placeholder={tags.find((t) => t.id === parseInt(selectedTag))?.settings?.placeholder || '输入你的提问...'}
           />
           <div className="absolute bottom-4 right-4">
             <InputEmojiPicker onSelect={handleEmojiInsert} />
@@ -322,7 +321,7 @@ export default function HomePage() {
             checked={hideArchive}
             onCheckedChange={(checked) => {
               setHideArchive(!!checked);
-              setPage(1);
+              setCursor('');
               setQuestions([]);
             }}
             className="mr-2"
@@ -333,7 +332,7 @@ export default function HomePage() {
           value={sortOrder}
           onValueChange={(v) => {
             setSortOrder(v as 'desc' | 'asc');
-            setPage(1);
+            setCursor('');
             setQuestions([]);
           }}
         >
@@ -12,7 +12,7 @@ import {
 } from '@/components/ui/select';
 import { PostCard } from '@/components/post-card';
 import { GoToTop } from '@/components/go-to-top';
-import { getQuestions, getTags, getInfo, Tag, Question } from '@/lib/api';
+import { getQuestions, getTags, flattenTags, getInfo, Tag, Question } from '@/lib/api';
 import { useWebSocket } from '@/hooks/useWebSocket';
 
 export default function SearchPage() {
@@ -28,7 +28,7 @@ export default function SearchPage() {
   useEffect(() => {
     getTags().then((res) => {
       if (res.code === 200 && res.data) {
-        setTags(res.data.reverse());
+        setTags(flattenTags(res.data));
       }
     });
 
@@ -2,16 +2,16 @@
 
 import { useState, useEffect } from 'react';
 import Link from 'next/link';
-import { getTags, Tag } from '@/lib/api';
+import { getTags, flattenTags, Tag } from '@/lib/api';
 import { GoToTop } from '@/components/go-to-top';
 
 export default function TagsPage() {
-  const [tags, setTags] = useState<Tag[]>([]);
+  const [tags, setTags] = useState<Array<Tag & { depth: number }>>([]);
 
   useEffect(() => {
     getTags().then((res) => {
       if (res.code === 200 && res.data) {
-        setTags(res.data);
+        setTags(flattenTags(res.data));
       }
     });
   }, []);
@@ -24,18 +24,23 @@ export default function TagsPage() {
             key={tag.id}
             className={`${index !== tags.length - 1 ? 'border-b-2 border-dashed border-[var(--fabric-stitch)]' : ''}`}
           >
-            <div className="flex items-center justify-between px-5 py-2.5">
-              <Link
-                href={`/tags/detail?id=${tag.id}&name=${encodeURIComponent(tag.tag_name)}`}
-                className="text-primary hover:underline transition-colors duration-200"
-              >
-                #{tag.tag_name}
-              </Link>
+            <div className="flex items-center justify-between px-5 py-2.5" style={{ paddingLeft: `${1.25 + tag.depth * 1.5}rem` }}>
+              <div className="flex items-center">
+                {tag.cover_image && (
+                  <img src={tag.cover_image} alt="" className="w-8 h-8 rounded object-cover mr-2" />
+                )}
+                <Link
+                  href={`/tags/detail?id=${tag.id}&name=${encodeURIComponent(tag.tag_name)}`}
+                  className="text-primary hover:underline transition-colors duration-200"
+                >
+                  #{tag.tag_name}
+                </Link>
+              </div>
               <span className="text-muted-foreground text-xs ml-2">
                 投稿数：{tag.question_count}
               </span>
             </div>
-            <div className="text-muted-foreground text-sm px-5 pb-2.5">
+            <div className="text-muted-foreground text-sm px-5 pb-2.5" style={{ paddingLeft: `${1.25 + tag.depth * 1.5}rem` }}>
               {tag.description}
             </div>
           </div>
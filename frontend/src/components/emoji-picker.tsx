@@ -1,31 +1,9 @@
 'use client';
 
 import { useState, useRef, useEffect } from 'react';
-import { addEmoji, EmojiData } from '@/lib/api';
-
-const EMOJIS = [
-  { id: 0, value: '👍', asset: '/emojis/76.png' },
-  { id: 1, value: '👎', asset: '/emojis/77.png' },
-  { id: 2, value: '🤣', asset: null },
-  { id: 3, value: '😭', asset: null },
-  { id: 4, value: '😓', asset: null },
-  { id: 5, value: '😬', asset: null },
-  { id: 6, value: '🥳', asset: null },
-  { id: 7, value: '😨', asset: null },
-  { id: 8, value: '😠', asset: null },
-  { id: 9, value: '💩', asset: '/emojis/59.png' },
-  { id: 10, value: '💖', asset: '/emojis/66.png' },
-  { id: 11, value: '🐵', asset: null },
-  { id: 12, value: '❓', asset: null },
-  { id: 13, value: '🫂', asset: '/emojis/49.png' },
-  { id: 14, value: '🔘', asset: '/emojis/424.png' },
-  { id: 15, value: '👅', asset: '/emojis/339.png' },
-  { id: 16, value: '🥺', asset: '/emojis/111.png' },
-  { id: 17, value: '👻', asset: '/emojis/187.png' },
-  { id: 18, value: '😅', asset: null },
-  { id: 19, value: '🌹', asset: '/emojis/63.png' },
-];
+import { addEmoji, getEmojis, EmojiData, EmojiItem } from '@/lib/api';
 
+// Bundled artwork for unicode emojis
 const EMOJI_MAP: Record<string, string | null> = {
   '👍': '/emojis/76.png',
   '👎': '/emojis/77.png',
@@ -49,6 +27,27 @@ const EMOJI_MAP: Record<string, string | null> = {
   '🌹': '/emojis/63.png',
 };
 
+// The catalog is shared by every picker on the page
+let catalogPromise: Promise<EmojiItem[]> | null = null;
+
+function loadCatalog(): Promise<EmojiItem[]> {
+  if (!catalogPromise) {
+    catalogPromise = getEmojis()
+      .then((res) => (res.code === 200 && res.data ? res.data : []))
+      .catch(() => {
+        catalogPromise = null;
+        return [];
+      });
+  }
+  return catalogPromise;
+}
+
+function emojiAsset(value: string, catalog: EmojiItem[]): string | null {
+  const item = catalog.find((e) => e.value === value);
+  if (item && item.type === 'image') return item.image_url;
+  return EMOJI_MAP[value] ?? null;
+}
+
 interface EmojiPickerProps {
   questionId: number;
   emojis: EmojiData[];
@@ -56,12 +55,17 @@ interface EmojiPickerProps {
 
 export function EmojiPicker({ questionId, emojis: emojisProp }: EmojiPickerProps) {
   const [panelOpen, setPanelOpen] = useState(false);
-  const [posted, setPosted] = useState(false);
+  const [mine, setMine] = useState<string[]>([]);
+  const [catalog, setCatalog] = useState<EmojiItem[]>([]);
   const pickerRef = useRef<HTMLDivElement>(null);
 
   // Sort emojis by count
   const emojis = [...emojisProp].sort((a, b) => b.count - a.count);
 
+  useEffect(() => {
+    loadCatalog().then(setCatalog);
+  }, []);
+
   // Close panel when clicking outside
   useEffect(() => {
     if (!panelOpen) return;
@@ -78,13 +82,12 @@ export function EmojiPicker({ questionId, emojis: emojisProp }: EmojiPickerProps
 
   const handlePostEmoji = async (value: string) => {
     setPanelOpen(false);
-    if (posted) return;
 
     try {
       const res = await addEmoji(questionId, value);
-      if (res.code === 200) {
-        setPosted(true);
-        // WebSocket will handle the sync to all users
+      if (res.code === 200 && res.data) {
+        // Clicking an emoji again removes it, WebSocket will handle the sync to all users
+        setMine(res.data.mine || []);
       }
     } catch (error) {
       console.error('Failed to post emoji:', error);
@@ -95,14 +98,14 @@ export function EmojiPicker({ questionId, emojis: emojisProp }: EmojiPickerProps
     <div ref={pickerRef} className="picker inline-block select-none relative">
       {panelOpen && (
         <div className="panel absolute bottom-12 right-4 w-[180px] z-[999] bg-card p-2.5 rounded border-2 border-dashed border-[var(--fabric-stitch)] grid grid-cols-4 shadow-lg">
-          {EMOJIS.map(({ id, value, asset }) => (
+          {catalog.map(({ id, value }) => (
             <div
               key={id}
               className="emoji-button flex text-base items-center justify-center cursor-pointer m-0.5 p-1 rounded hover:bg-accent transition-all duration-200"
               onClick={() => handlePostEmoji(value)}
             >
-              {asset ? (
-                <img src={asset} alt={value} height={16} width={16} />
+              {emojiAsset(value, catalog) ? (
+                <img src={emojiAsset(value, catalog)!} alt={value} height={16} width={16} />
               ) : (
                 value
               )}
@@ -114,11 +117,11 @@ export function EmojiPicker({ questionId, emojis: emojisProp }: EmojiPickerProps
         {emojis.map(({ value, count }) => (
           <div
             key={value}
-            className="emoji-button flex text-base items-center cursor-pointer m-0.5 px-1 border border-dashed border-[var(--fabric-stitch)] rounded hover:bg-accent transition-all duration-200"
+            className={`emoji-button flex text-base items-center cursor-pointer m-0.5 px-1 border border-dashed border-[var(--fabric-stitch)] rounded hover:bg-accent transition-all duration-200 ${mine.includes(value) ? 'bg-accent' : ''}`}
             onClick={() => handlePostEmoji(value)}
           >
-            {EMOJI_MAP[value] ? (
-              <img src={EMOJI_MAP[value]!} alt={value} height={16} width={16} />
+            {emojiAsset(value, catalog) ? (
+              <img src={emojiAsset(value, catalog)!} alt={value} height={16} width={16} />
             ) : (
               value
             )}
@@ -1,10 +1,36 @@
+import { solve } from './pow';
+
 const API_BASE = '/api';
 
+export interface TagSettings {
+  images_disabled: boolean;
+  max_images: number;
+  max_content_length: number;
+  auto_publish: boolean;
+  is_hidden: boolean;
+  placeholder: string;
+}
+
+export interface TagCounts {
+  total: number;
+  published: number;
+  pending: number;
+  archived: number;
+  rainbow: number;
+}
+
 export interface Tag {
   id: number;
   tag_name: string;
   description: string;
   question_count: number;
+  parent_id?: number;
+  sort_order?: number;
+  cover_image?: string;
+  accepting?: boolean;
+  settings?: TagSettings;
+  counts?: TagCounts;
+  children?: Tag[];
   created_at: string;
   updated_at: string;
 }
@@ -16,6 +42,7 @@ export interface EmojiData {
 
 export interface Question {
   id: number;
+  public_id: string;
   tag_id: number;
   tag: Tag;
   content: string;
@@ -27,12 +54,19 @@ export interface Question {
   is_publish: boolean;
   emojis: string;
   likes: number;
+  session_id: number;
   created_at: string;
   updated_at: string;
 }
 
+export interface SubmissionState {
+  open: boolean;
+  next_change: string | null;
+}
+
 export interface Config {
   announcement: string;
+  submission?: SubmissionState;
 }
 
 export interface ApiResponse<T> {
@@ -43,9 +77,10 @@ export interface ApiResponse<T> {
 
 export interface QuestionsResponse {
   questions: Question[];
-  page: number;
+  page?: number;
   page_size: number;
-  total: number;
+  total?: number;
+  next_cursor?: string;
 }
 
 export async function getInfo(): Promise<ApiResponse<{ id: number; username: string }>> {
@@ -66,6 +101,7 @@ export async function getConfig(): Promise<ApiResponse<Config>> {
 
 export async function getQuestions(params: {
   page?: number;
+  cursor?: string;
   size?: number;
   order_by?: string;
   order?: string;
@@ -77,6 +113,7 @@ export async function getQuestions(params: {
 }): Promise<ApiResponse<QuestionsResponse>> {
   const searchParams = new URLSearchParams();
   if (params.page) searchParams.set('page', params.page.toString());
+  if (params.cursor !== undefined) searchParams.set('cursor', params.cursor);
   if (params.size) searchParams.set('size', params.size.toString());
   if (params.order_by) searchParams.set('order_by', params.order_by);
   if (params.order) searchParams.set('order', params.order);
@@ -93,7 +130,59 @@ export async function getQuestions(params: {
   return res.json();
 }
 
+export async function getQuestion(publicId: string): Promise<ApiResponse<Question>> {
+  const res = await fetch(`${API_BASE}/question/${encodeURIComponent(publicId)}`, {
+    method: 'GET',
+    credentials: 'include',
+  });
+  return res.json();
+}
+
+export interface Challenge {
+  challenge: string;
+  difficulty: number;
+  expires_at: number;
+}
+
+export async function getChallenge(): Promise<ApiResponse<Challenge>> {
+  const res = await fetch(`${API_BASE}/challenge`, {
+    method: 'GET',
+    credentials: 'include',
+  });
+  return res.json();
+}
+
+// Solve the challenge in a worker so the page stays responsive while hashing.
+function solveChallenge(challenge: string, difficulty: number): Promise<string> {
+  if (typeof Worker === 'undefined') {
+    return Promise.resolve(solve(challenge, difficulty));
+  }
+  return new Promise((resolve, reject) => {
+    const worker = new Worker(new URL('./pow.worker.ts', import.meta.url));
+    worker.onmessage = (e: MessageEvent<string>) => {
+      worker.terminate();
+      resolve(e.data);
+    };
+    worker.onerror = (e) => {
+      worker.terminate();
+      reject(e);
+    };
+    worker.postMessage({ challenge, difficulty });
+  });
+}
+
+// ChallengeError is thrown when no challenge could be fetched, the server
+// rejects submissions without a solved challenge.
+export class ChallengeError extends Error {}
+
 export async function createQuestion(data: FormData): Promise<Response> {
+  const challenge = await getChallenge();
+  if (challenge.code !== 200) {
+    throw new ChallengeError(challenge.message || '获取人机验证失败，请重试');
+  }
+  const nonce = await solveChallenge(challenge.data.challenge, challenge.data.difficulty);
+  data.set('pow_challenge', challenge.data.challenge);
+  data.set('pow_nonce', nonce);
   return fetch(`${API_BASE}/question`, {
     method: 'POST',
     credentials: 'include',
@@ -117,7 +206,30 @@ export async function updateQuestion(id: number, data: {
   return res.json();
 }
 
-export async function addEmoji(questionId: number, emoji: string): Promise<ApiResponse<null>> {
+export interface EmojiItem {
+  id: number;
+  value: string;
+  name: string;
+  type: 'unicode' | 'image';
+  image_url: string;
+  enabled: boolean;
+  sort_order: number;
+}
+
+export async function getEmojis(): Promise<ApiResponse<EmojiItem[]>> {
+  const res = await fetch(`${API_BASE}/emoji`, {
+    method: 'GET',
+    credentials: 'include',
+  });
+  return res.json();
+}
+
+export interface EmojiToggleResponse {
+  emojis: EmojiData[];
+  mine: string[];
+}
+
+export async function addEmoji(questionId: number, emoji: string): Promise<ApiResponse<EmojiToggleResponse>> {
   const formData = new FormData();
   formData.append('emoji', emoji);
   const res = await fetch(`${API_BASE}/question/${questionId}/emoji`, {
@@ -128,6 +240,11 @@ export async function addEmoji(questionId: number, emoji: string): Promise<ApiRe
   return res.json();
 }
 
+// Flatten the tag tree in display order, depth is the nesting level
+export function flattenTags(tags: Tag[], depth = 0): Array<Tag & { depth: number }> {
+  return tags.flatMap((tag) => [{ ...tag, depth }, ...flattenTags(tag.children || [], depth + 1)]);
+}
+
 export async function getTags(): Promise<ApiResponse<Tag[]>> {
   const res = await fetch(`${API_BASE}/tag`, {
     method: 'GET',
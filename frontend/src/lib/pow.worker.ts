@@ -0,0 +1,5 @@
+import { solve } from './pow';
+
+self.onmessage = (e: MessageEvent<{ challenge: string; difficulty: number }>) => {
+  self.postMessage(solve(e.data.challenge, e.data.difficulty));
+};
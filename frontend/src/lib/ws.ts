@@ -1,4 +1,4 @@
-import { EmojiData } from './api';
+import { EmojiData, Question } from './api';
 
 export interface WSEmojiData {
   Type: 1;
@@ -13,12 +13,29 @@ export interface WSArchiveData {
   Data: number;
 }
 
-export type WSData = WSEmojiData | WSArchiveData;
+export interface WSDrawData {
+  Type: 4;
+  Data: Question;
+}
+
+export interface WSTagMergeData {
+  Type: 5;
+  Data: {
+    source_id: number;
+    target_id: number;
+    moved: number;
+    deleted: boolean;
+  };
+}
+
+export type WSData = WSEmojiData | WSArchiveData | WSDrawData | WSTagMergeData;
 
 type EmojiCallback = (cardId: number, emojis: EmojiData[]) => void;
 type ArchiveCallback = (cardId: number) => void;
 type CursorCallback = (clientId: string, cardId: number, x: number, y: number) => void;
 type CursorLeaveCallback = (clientId: string) => void;
+type DrawCallback = (question: Question) => void;
+type TagMergeCallback = (sourceId: number, targetId: number) => void;
 
 interface Subscriber {
   id: string;
@@ -26,6 +43,8 @@ interface Subscriber {
   onArchive: ArchiveCallback;
   onCursor?: CursorCallback;
   onCursorLeave?: CursorLeaveCallback;
+  onDraw?: DrawCallback;
+  onTagMerge?: TagMergeCallback;
 }
 
 // Singleton WebSocket manager
@@ -88,6 +107,10 @@ class WSManager {
           this.subscribers.forEach(sub => sub.onEmoji(wsData.Data.card_id, wsData.Data.emojis));
         } else if (wsData.Type === 2) {
           this.subscribers.forEach(sub => sub.onArchive(wsData.Data));
+        } else if (wsData.Type === 4) {
+          this.subscribers.forEach(sub => sub.onDraw?.(wsData.Data));
+        } else if (wsData.Type === 5) {
+          this.subscribers.forEach(sub => sub.onTagMerge?.(wsData.Data.source_id, wsData.Data.target_id));
         }
       } catch (e) {
         console.error('[WS] Failed to parse message:', e);
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"joiask-backend/internal/logging"
+	"joiask-backend/internal/pow"
+	"joiask-backend/internal/storage"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var log = logging.Logger("config")
+
+// DefaultPath is the config file used when no --config flag is given
+const DefaultPath = "./config/config.json"
+
+// EnvPrefix prefixes the environment variables overriding config keys, a key
+// such as oss.secret_key is overridden by JASK_OSS_SECRET_KEY.
+const EnvPrefix = "JASK"
+
+type Config struct {
+	DBType      string   `mapstructure:"db_type" json:"db_type"`
+	SQLite      string   `mapstructure:"sqlite" json:"sqlite"`
+	MySQL       MySQL    `mapstructure:"mysql" json:"mysql"`
+	Server      Server   `mapstructure:"server" json:"server"`
+	StorageType string   `mapstructure:"storage_type" json:"storage_type"`
+	OSS         OSS      `mapstructure:"oss" json:"oss"`
+	Session     Session  `mapstructure:"session" json:"session"`
+	Pow         Pow      `mapstructure:"pow" json:"pow"`
+	Security    Security `mapstructure:"security" json:"security"`
+	Hot         Hot      `mapstructure:"hot" json:"hot"`
+	Timezone    string   `mapstructure:"timezone" json:"timezone"`
+	Metrics     Metrics  `mapstructure:"metrics" json:"metrics"`
+	Log         Log      `mapstructure:"log" json:"log"`
+}
+
+type MySQL struct {
+	Host string `mapstructure:"host" json:"host"`
+	Port int    `mapstructure:"port" json:"port"`
+	User string `mapstructure:"user" json:"user"`
+	Pass string `mapstructure:"pass" json:"pass"`
+	Name string `mapstructure:"name" json:"name"`
+}
+
+type Server struct {
+	Host string `mapstructure:"host" json:"host"`
+	Port int    `mapstructure:"port" json:"port"`
+	// ShutdownTimeout is in seconds
+	ShutdownTimeout int `mapstructure:"shutdown_timeout" json:"shutdown_timeout"`
+}
+
+type OSS struct {
+	Address   string `mapstructure:"address" json:"address"`
+	Endpoint  string `mapstructure:"endpoint" json:"endpoint"`
+	AccessKey string `mapstructure:"access_key" json:"access_key"`
+	SecretKey string `mapstructure:"secret_key" json:"secret_key"`
+	Bucket    string `mapstructure:"bucket" json:"bucket"`
+}
+
+type Session struct {
+	Secret string `mapstructure:"secret" json:"secret"`
+}
+
+type Pow struct {
+	Secret string `mapstructure:"secret" json:"secret"`
+	// TTL is in seconds
+	TTL           int `mapstructure:"ttl" json:"ttl"`
+	MinDifficulty int `mapstructure:"min_difficulty" json:"min_difficulty"`
+	MaxDifficulty int `mapstructure:"max_difficulty" json:"max_difficulty"`
+	Step          int `mapstructure:"step" json:"step"`
+}
+
+type Security struct {
+	IPSalt string `mapstructure:"ip_salt" json:"ip_salt"`
+	IDSalt string `mapstructure:"id_salt" json:"id_salt"`
+}
+
+type Hot struct {
+	// HalfLife is in hours
+	HalfLife float64 `mapstructure:"half_life" json:"half_life"`
+}
+
+type Metrics struct {
+	Token string `mapstructure:"token" json:"token"`
+}
+
+type Log struct {
+	Format string `mapstructure:"format" json:"format"`
+	Level  string `mapstructure:"level" json:"level"`
+	// Levels by subsystem, overridden by JASK_LOG_LEVELS_<SUBSYSTEM>
+	Levels map[string]string `mapstructure:"levels" json:"levels"`
+}
+
+// keys returns the dotted keys of every config field, maps are skipped as
+// their keys are not known in advance.
+func keys(t reflect.Type, prefix string) []string {
+	var list []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := prefix + field.Tag.Get("mapstructure")
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			list = append(list, keys(field.Type, key+".")...)
+		case reflect.Map:
+		default:
+			list = append(list, key)
+		}
+	}
+	return list
+}
+
+// EnvName returns the environment variable overriding a key
+func EnvName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Load reads the config file into viper with environment overrides applied,
+// and returns the typed config. The file may be missing at the default path,
+// so that a deployment can be configured by environment only.
+func Load(path string) (*Config, error) {
+	viper.SetConfigFile(path)
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+	viper.SetDefault("server.port", 8080)
+	// Keys only set by environment are otherwise unknown to viper
+	for _, key := range keys(reflect.TypeOf(Config{}), "") {
+		if err := viper.BindEnv(key, EnvName(key)); err != nil {
+			return nil, err
+		}
+	}
+	if err := viper.ReadInConfig(); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) || path != DefaultPath {
+			return nil, err
+		}
+		log.Warn("Config file not found, using environment variables only")
+	}
+	var c Config
+	if err := viper.Unmarshal(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate checks the config and returns every problem found at once.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, a ...any) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+	missing := func(section string, fields map[string]string) {
+		var names []string
+		for name, value := range fields {
+			if value == "" {
+				names = append(names, section+"."+name)
+			}
+		}
+		if len(names) > 0 {
+			// Sorted so the message is stable
+			sort.Strings(names)
+			add("%s must be set", strings.Join(names, ", "))
+		}
+	}
+
+	switch c.DBType {
+	case "sqlite":
+		if c.SQLite == "" {
+			add("sqlite must be set to the database file when db_type is sqlite")
+		}
+	case "mysql":
+		missing("mysql", map[string]string{"host": c.MySQL.Host, "user": c.MySQL.User, "name": c.MySQL.Name})
+		if c.MySQL.Port < 1 || c.MySQL.Port > 65535 {
+			add("mysql.port must be between 1 and 65535, got %d", c.MySQL.Port)
+		}
+	default:
+		add("db_type must be sqlite or mysql, got %q", c.DBType)
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		add("server.port must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	if c.Server.ShutdownTimeout < 0 {
+		add("server.shutdown_timeout must not be negative")
+	}
+
+	if _, err := storage.StrToType(c.StorageType); err != nil {
+		add("storage_type must be local or oss, got %q", c.StorageType)
+	}
+	if c.StorageType == "oss" {
+		missing("oss", map[string]string{
+			"address":    c.OSS.Address,
+			"endpoint":   c.OSS.Endpoint,
+			"access_key": c.OSS.AccessKey,
+			"secret_key": c.OSS.SecretKey,
+			"bucket":     c.OSS.Bucket,
+		})
+	}
+
+	if c.Pow.TTL < 0 {
+		add("pow.ttl must not be negative")
+	}
+	if c.Pow.MinDifficulty < 0 || c.Pow.MaxDifficulty < 0 || c.Pow.Step < 0 {
+		add("pow.min_difficulty, pow.max_difficulty and pow.step must not be negative")
+	}
+	if c.Pow.MinDifficulty > 0 && c.Pow.MaxDifficulty > 0 && c.Pow.MaxDifficulty < c.Pow.MinDifficulty {
+		add("pow.max_difficulty must not be less than pow.min_difficulty")
+	}
+	if c.Pow.MinDifficulty > pow.MaxAllowedDifficulty || c.Pow.MaxDifficulty > pow.MaxAllowedDifficulty {
+		add("pow.min_difficulty and pow.max_difficulty must not exceed %d", pow.MaxAllowedDifficulty)
+	}
+	if c.Security.IPSalt == "" {
+		add("security.ip_salt must be set, without it stored IP hashes can be reversed")
+	}
+	if c.Security.IDSalt == "" {
+		add("security.id_salt must be set, without it public question ids can be enumerated")
+	}
+	if c.Hot.HalfLife < 0 {
+		add("hot.half_life must not be negative")
+	}
+
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			add("timezone %q is unknown", c.Timezone)
+		}
+	}
+
+	switch c.Log.Format {
+	case "", "text", "json":
+	default:
+		add("log.format must be text or json, got %q", c.Log.Format)
+	}
+	if c.Log.Level != "" {
+		if _, err := logrus.ParseLevel(c.Log.Level); err != nil {
+			add("log.level %q is unknown", c.Log.Level)
+		}
+	}
+	for subsystem, level := range c.Log.Levels {
+		if _, err := logrus.ParseLevel(level); err != nil {
+			add("log.levels.%s %q is unknown", subsystem, level)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy with the secrets masked, for printing.
+func (c Config) Redacted() Config {
+	for _, secret := range []*string{
+		&c.MySQL.Pass,
+		&c.OSS.AccessKey,
+		&c.OSS.SecretKey,
+		&c.Session.Secret,
+		&c.Pow.Secret,
+		&c.Security.IPSalt,
+		&c.Security.IDSalt,
+		&c.Metrics.Token,
+	} {
+		if *secret != "" {
+			*secret = "******"
+		}
+	}
+	return c
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// validConfig returns a minimal config that passes Validate.
+func validConfig() Config {
+	return Config{
+		DBType:      "sqlite",
+		SQLite:      "./db/ask.db",
+		Server:      Server{Port: 8080},
+		StorageType: "local",
+		Security:    Security{IPSalt: "ip salt", IDSalt: "id salt"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		// want lists substrings of the error, none means valid
+		want []string
+	}{
+		{"valid", func(c *Config) {}, nil},
+		{"mysql", func(c *Config) {
+			c.DBType = "mysql"
+			c.MySQL = MySQL{Host: "db", Port: 3306, User: "jask", Name: "jask"}
+		}, nil},
+		{"oss", func(c *Config) {
+			c.StorageType = "oss"
+			c.OSS = OSS{Address: "a", Endpoint: "e", AccessKey: "k", SecretKey: "s", Bucket: "b"}
+		}, nil},
+		{"every option", func(c *Config) {
+			c.Timezone = "Asia/Shanghai"
+			c.Pow = Pow{TTL: 300, MinDifficulty: 16, MaxDifficulty: 20, Step: 10}
+			c.Log = Log{Format: "json", Level: "debug", Levels: map[string]string{"database": "warn"}}
+		}, nil},
+		{"unknown db_type", func(c *Config) { c.DBType = "postgres" }, []string{`db_type must be sqlite or mysql, got "postgres"`}},
+		{"missing sqlite file", func(c *Config) { c.SQLite = "" }, []string{"sqlite must be set"}},
+		{"incomplete mysql", func(c *Config) {
+			c.DBType = "mysql"
+			c.MySQL = MySQL{Host: "db"}
+		}, []string{"mysql.name, mysql.user must be set", "mysql.port must be between 1 and 65535, got 0"}},
+		{"server port", func(c *Config) { c.Server.Port = 70000 }, []string{"server.port must be between 1 and 65535, got 70000"}},
+		{"shutdown timeout", func(c *Config) { c.Server.ShutdownTimeout = -1 }, []string{"server.shutdown_timeout must not be negative"}},
+		{"unknown storage", func(c *Config) { c.StorageType = "s3" }, []string{`storage_type must be local or oss, got "s3"`}},
+		{"incomplete oss", func(c *Config) {
+			c.StorageType = "oss"
+			c.OSS = OSS{Address: "a", Endpoint: "e"}
+		}, []string{"oss.access_key, oss.bucket, oss.secret_key must be set"}},
+		{"negative pow", func(c *Config) { c.Pow.Step = -1 }, []string{"pow.min_difficulty, pow.max_difficulty and pow.step must not be negative"}},
+		{"pow range", func(c *Config) { c.Pow.MinDifficulty, c.Pow.MaxDifficulty = 18, 16 }, []string{"pow.max_difficulty must not be less than pow.min_difficulty"}},
+		{"pow cap", func(c *Config) { c.Pow.MaxDifficulty = 24 }, []string{"must not exceed 20"}},
+		{"missing ip_salt", func(c *Config) { c.Security.IPSalt = "" }, []string{"security.ip_salt must be set"}},
+		{"missing id_salt", func(c *Config) { c.Security.IDSalt = "" }, []string{"security.id_salt must be set"}},
+		{"negative half life", func(c *Config) { c.Hot.HalfLife = -1 }, []string{"hot.half_life must not be negative"}},
+		{"unknown timezone", func(c *Config) { c.Timezone = "Mars/Olympus" }, []string{`timezone "Mars/Olympus" is unknown`}},
+		{"log format", func(c *Config) { c.Log.Format = "xml" }, []string{`log.format must be text or json, got "xml"`}},
+		{"log level", func(c *Config) { c.Log.Level = "loud" }, []string{`log.level "loud" is unknown`}},
+		{"subsystem log level", func(c *Config) {
+			c.Log.Levels = map[string]string{"pow": "quiet"}
+		}, []string{`log.levels.pow "quiet" is unknown`}},
+		{"every problem at once", func(c *Config) {
+			c.DBType = ""
+			c.Security = Security{}
+			c.Log.Format = "xml"
+		}, []string{"db_type", "security.ip_salt", "security.id_salt", "log.format"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(&c)
+			err := c.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := validConfig()
+	c.MySQL.Pass = "pass"
+	c.Metrics.Token = ""
+	redacted := c.Redacted()
+	if redacted.MySQL.Pass != "******" || redacted.Security.IPSalt != "******" || redacted.Security.IDSalt != "******" {
+		t.Errorf("Redacted() kept a secret: %+v", redacted)
+	}
+	if redacted.Metrics.Token != "" {
+		t.Errorf("Redacted() masked an empty secret: %q", redacted.Metrics.Token)
+	}
+	if c.MySQL.Pass != "pass" {
+		t.Errorf("Redacted() changed the config")
+	}
+}
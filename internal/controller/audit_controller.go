@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"joiask-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct{}
+
+// Get the latest audit entries, optionally of one action
+func (*AuditController) Get(c *gin.Context) {
+	var list []database.AuditLog
+	tx := database.DB.Order("id desc").Limit(200)
+	if action := c.Query("action"); action != "" {
+		tx = tx.Where("action = ?", action)
+	}
+	if err := tx.Find(&list).Error; err != nil {
+		logger(c).Errorf("failed to get audit logs: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	Success(c, list)
+}
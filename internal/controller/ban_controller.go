@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"joiask-backend/internal/database"
+	"joiask-backend/pkg/util"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+type BanController struct{}
+
+type BanRequest struct {
+	Target    string     `json:"target"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// banList caches all bans in memory, it is reloaded after every modification.
+type banList struct {
+	mutex  sync.RWMutex
+	loaded bool
+	bans   []database.Ban
+	nets   map[uint]*net.IPNet
+}
+
+var bans banList
+
+func (b *banList) reload() error {
+	var list []database.Ban
+	if err := database.DB.Find(&list).Error; err != nil {
+		return err
+	}
+	nets := make(map[uint]*net.IPNet)
+	for _, ban := range list {
+		if ban.Target == "" {
+			continue
+		}
+		if n := parseTarget(ban.Target); n != nil {
+			nets[ban.ID] = n
+		}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.bans = list
+	b.nets = nets
+	b.loaded = true
+	return nil
+}
+
+func (b *banList) invalidate() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.loaded = false
+}
+
+// match returns the active ban matching ip, or nil.
+func (b *banList) match(c *gin.Context, ip string) *database.Ban {
+	b.mutex.RLock()
+	loaded := b.loaded
+	b.mutex.RUnlock()
+	if !loaded {
+		if err := b.reload(); err != nil {
+			logger(c).Errorf("failed to load bans: %v", err)
+			return nil
+		}
+	}
+	addr := net.ParseIP(ip)
+	hash := hashIP(ip)
+	now := time.Now()
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for i := range b.bans {
+		ban := &b.bans[i]
+		if ban.ExpiresAt != nil && now.After(*ban.ExpiresAt) {
+			continue
+		}
+		if ban.IPHash != "" && ban.IPHash == hash {
+			return ban
+		}
+		if n, ok := b.nets[ban.ID]; ok && addr != nil && n.Contains(addr) {
+			return ban
+		}
+	}
+	return nil
+}
+
+// parseTarget parses a single IP or a CIDR range into a network.
+func parseTarget(target string) *net.IPNet {
+	if strings.Contains(target, "/") {
+		_, n, err := net.ParseCIDR(target)
+		if err != nil {
+			return nil
+		}
+		return n
+	}
+	ip := net.ParseIP(target)
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// hashIP returns the salted hash of ip that is stored instead of the ip itself.
+func hashIP(ip string) string {
+	return util.HmacSha256(viper.GetString("security.ip_salt"), ip)
+}
+
+// checkBan fails the request and returns true if the client is banned.
+func checkBan(c *gin.Context) bool {
+	ban := bans.match(c, c.ClientIP())
+	if ban == nil {
+		return false
+	}
+	Fail(c, 403, "您已被禁止访问")
+	return true
+}
+
+// Get all bans
+func (*BanController) Get(c *gin.Context) {
+	var list []database.Ban
+	if err := database.DB.Order("id desc").Find(&list).Error; err != nil {
+		logger(c).Errorf("failed to get bans: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	Success(c, list)
+}
+
+// Post create a ban for an IP or CIDR range
+func (*BanController) Post(c *gin.Context) {
+	var request BanRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		Fail(c, 400, "请求错误")
+		return
+	}
+	request.Target = strings.TrimSpace(request.Target)
+	if parseTarget(request.Target) == nil {
+		Fail(c, 400, "无效的IP或网段")
+		return
+	}
+	ban := database.Ban{
+		Target:    request.Target,
+		Reason:    request.Reason,
+		CreatedBy: c.MustGet("user").(database.Admin).ID,
+		ExpiresAt: request.ExpiresAt,
+	}
+	if err := database.DB.Create(&ban).Error; err != nil {
+		logger(c).Errorf("failed to create ban: %v", err)
+		Fail(c, 500, "创建封禁失败")
+		return
+	}
+	bans.invalidate()
+	Success(c, ban)
+}
+
+// BanSubmitter bans the submitter of a question by its hashed IP
+func (*BanController) BanSubmitter(c *gin.Context) {
+	var request BanRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		Fail(c, 400, "请求错误")
+		return
+	}
+	var q database.Question
+	database.DB.First(&q, c.Param("id"))
+	if q.ID == 0 {
+		Fail(c, 404, "提问不存在")
+		return
+	}
+	if q.SubmitterHash == "" {
+		Fail(c, 400, "该提问没有记录提问者")
+		return
+	}
+	ban := database.Ban{
+		IPHash:     q.SubmitterHash,
+		QuestionID: int(q.ID),
+		Reason:     request.Reason,
+		CreatedBy:  c.MustGet("user").(database.Admin).ID,
+		ExpiresAt:  request.ExpiresAt,
+	}
+	if err := database.DB.Create(&ban).Error; err != nil {
+		logger(c).Errorf("failed to create ban: %v", err)
+		Fail(c, 500, "创建封禁失败")
+		return
+	}
+	bans.invalidate()
+	Success(c, ban)
+}
+
+func (*BanController) Delete(c *gin.Context) {
+	var ban database.Ban
+	database.DB.First(&ban, c.Param("id"))
+	if ban.ID == 0 {
+		Fail(c, 404, "封禁不存在")
+		return
+	}
+	if err := database.DB.Delete(&ban).Error; err != nil {
+		logger(c).Errorf("failed to delete ban: %v", err)
+		Fail(c, 500, "删除封禁失败")
+		return
+	}
+	bans.invalidate()
+	Success(c, nil)
+}
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"joiask-backend/internal/pow"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ChallengeController struct{}
+
+// Get issues a new proof-of-work challenge for question submission
+func (*ChallengeController) Get(c *gin.Context) {
+	token, challenge, err := pow.Get().Issue()
+	if err != nil {
+		logger(c).Errorf("failed to issue challenge: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	Success(c, gin.H{
+		"challenge":  token,
+		"difficulty": challenge.Difficulty,
+		"expires_at": challenge.ExpiresAt,
+	})
+}
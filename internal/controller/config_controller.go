@@ -2,20 +2,24 @@ package controller
 
 import (
 	"joiask-backend/internal/database"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
 )
 
 type ConfigController struct{}
 
 type ConfigRequest struct {
 	Announcement string `json:"announcement"`
+	// Window is kept if not given
+	Window *database.SubmissionWindow `json:"window"`
 }
 
 func (*ConfigController) Get(c *gin.Context) {
 	var config database.Config
 	database.DB.First(&config)
+	state := database.SubmissionStateOf(time.Now(), config.Window)
+	config.Submission = &state
 	Success(c, config)
 }
 
@@ -25,13 +29,31 @@ func (*ConfigController) Put(c *gin.Context) {
 		Fail(c, 400, "请求错误")
 		return
 	}
+	if request.Window != nil {
+		if err := request.Window.Validate(); err != nil {
+			Fail(c, 400, "无效的开放时间")
+			return
+		}
+	}
 	var config database.Config
-	database.DB.First(&config)
+	if err := database.DB.First(&config).Error; err != nil {
+		logger(c).Errorf("failed to get config: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	// Only the edited columns, the on-air question is changed concurrently
+	columns := []string{"announcement", "updated_at"}
 	config.Announcement = request.Announcement
-	if err := database.DB.Save(&config).Error; err != nil {
-		log.Errorf("failed to save config: %v", err)
+	if request.Window != nil {
+		config.Window = *request.Window
+		columns = append(columns, "window_mode", "window_open_at", "window_close_at", "window_weekly")
+	}
+	if err := database.DB.Model(&config).Select(columns).Updates(&config).Error; err != nil {
+		logger(c).Errorf("failed to save config: %v", err)
 		Fail(c, 500, "内部错误")
 		return
 	}
+	state := database.SubmissionStateOf(time.Now(), config.Window)
+	config.Submission = &state
 	Success(c, config)
 }
@@ -1,10 +1,28 @@
 package controller
 
 import (
+	"errors"
+	"joiask-backend/internal/database"
+	"joiask-backend/internal/logging"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
+var log = logging.Logger("controller")
+
+// RequestIDKey is the context key of the request id
+const RequestIDKey = "request_id"
+
+// logger returns the logger of a request, its entries carry the request id
+func logger(c *gin.Context) *logrus.Entry {
+	return log.WithField("request_id", c.GetString(RequestIDKey))
+}
+
 func Success(c *gin.Context, data interface{}) {
 	c.JSON(200, gin.H{
 		"code":    200,
@@ -13,11 +31,13 @@ func Success(c *gin.Context, data interface{}) {
 	})
 }
 
+// Fail responds with an error, the request id lets it be matched with the logs
 func Fail(c *gin.Context, code int, message string) {
 	c.AbortWithStatusJSON(200, gin.H{
-		"code":    code,
-		"message": message,
-		"data":    nil,
+		"code":       code,
+		"message":    message,
+		"data":       nil,
+		"request_id": c.GetString(RequestIDKey),
 	})
 }
 
@@ -35,6 +55,8 @@ func getOrderBy(orderBy string) string {
 		return "is_archive"
 	case "is_publish":
 		return "is_publish"
+	case "hot":
+		return "hot"
 	default:
 		return "id"
 	}
@@ -80,3 +102,42 @@ func paginate(page int, size int) func(db *gorm.DB) *gorm.DB {
 		return db.Offset(offset).Limit(size)
 	}
 }
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseTime parses a time parameter in the configured time zone. A date without time is the
+// start of that day, or the start of the next day if endOfDay is set so that
+// it can be used as an exclusive upper bound covering the whole day. The result
+// is in the stored zone so that it can be bound against time columns.
+func parseTime(v string, endOfDay bool) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		t, err := time.ParseInLocation(layout, v, database.Location())
+		if err != nil {
+			continue
+		}
+		if layout == "2006-01-02" && endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return database.StoredTime(t), nil
+	}
+	return time.Time{}, errors.New("invalid time: " + v)
+}
+
+// parseIDs parses ids given as repeated and/or comma separated parameters.
+func parseIDs(values []string) ([]int, error) {
+	var ids []int
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			id, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
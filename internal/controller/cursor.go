@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"joiask-backend/internal/database"
+	"strings"
+	"time"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type sortKey struct {
+	Column string
+	Desc   bool
+}
+
+func (k sortKey) String() string {
+	if k.Desc {
+		return k.Column + " desc"
+	}
+	return k.Column + " asc"
+}
+
+// questionSortKeys returns the full ordering of the question list: the requested
+// column, the forced is_archive asc, and id as tiebreaker so the order is total.
+func questionSortKeys(orderBy string, order string) []sortKey {
+	column := getOrderBy(orderBy)
+	desc := getOrder(order) == "desc"
+	keys := []sortKey{{Column: column, Desc: desc}}
+	if column != "is_archive" {
+		keys = append(keys, sortKey{Column: "is_archive"})
+	}
+	if column != "id" {
+		keys = append(keys, sortKey{Column: "id", Desc: desc})
+	}
+	return keys
+}
+
+// sortValue returns the value of column for q, as it is bound in a query.
+func sortValue(q database.Question, column string) interface{} {
+	switch column {
+	case "created_at":
+		return q.CreatedAt
+	case "is_hide":
+		return q.IsHide
+	case "is_rainbow":
+		return q.IsRainbow
+	case "is_archive":
+		return q.IsArchive
+	case "is_publish":
+		return q.IsPublish
+	case "hot":
+		return q.Hot
+	default:
+		return q.ID
+	}
+}
+
+type cursorPayload struct {
+	Order  string            `json:"o"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// orderSignature identifies an ordering, a cursor is only valid for the
+// ordering it was created with.
+func orderSignature(keys []sortKey) string {
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// encodeCursor returns the opaque cursor pointing after q.
+func encodeCursor(keys []sortKey, q database.Question) (string, error) {
+	payload := cursorPayload{Order: orderSignature(keys)}
+	for _, k := range keys {
+		v, err := json.Marshal(sortValue(q, k.Column))
+		if err != nil {
+			return "", err
+		}
+		payload.Values = append(payload.Values, v)
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor returns the typed sort values stored in cursor.
+func decodeCursor(keys []sortKey, cursor string) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(b, &payload); err != nil {
+		return nil, errInvalidCursor
+	}
+	if payload.Order != orderSignature(keys) || len(payload.Values) != len(keys) {
+		return nil, errInvalidCursor
+	}
+	values := make([]interface{}, 0, len(keys))
+	for i, k := range keys {
+		var err error
+		switch k.Column {
+		case "created_at":
+			var v time.Time
+			err = json.Unmarshal(payload.Values[i], &v)
+			values = append(values, v)
+		case "is_hide", "is_rainbow", "is_archive", "is_publish":
+			var v bool
+			err = json.Unmarshal(payload.Values[i], &v)
+			values = append(values, v)
+		case "hot":
+			var v float64
+			err = json.Unmarshal(payload.Values[i], &v)
+			values = append(values, v)
+		default:
+			var v uint
+			err = json.Unmarshal(payload.Values[i], &v)
+			values = append(values, v)
+		}
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+	}
+	return values, nil
+}
+
+// keysetCondition builds the condition selecting the rows after values in the
+// ordering keys: (k0 > v0) or (k0 = v0 and k1 > v1) or ...
+func keysetCondition(keys []sortKey, values []interface{}) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	for i, k := range keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, "questions."+keys[j].Column+" = ?")
+			args = append(args, values[j])
+		}
+		op := " > ?"
+		if k.Desc {
+			op = " < ?"
+		}
+		parts = append(parts, "questions."+k.Column+op)
+		args = append(args, values[i])
+		clauses = append(clauses, "("+strings.Join(parts, " and ")+")")
+	}
+	return strings.Join(clauses, " or "), args
+}
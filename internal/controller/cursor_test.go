@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"encoding/base64"
+	"joiask-backend/internal/database"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuestionSortKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		orderBy string
+		order   string
+		want    string
+	}{
+		{"defaults", "", "", "id desc,is_archive asc"},
+		{"unknown column", "content", "asc", "id asc,is_archive asc"},
+		{"unknown order", "hot", "sideways", "hot desc,is_archive asc,id desc"},
+		{"created_at asc", "created_at", "asc", "created_at asc,is_archive asc,id asc"},
+		{"is_archive", "is_archive", "desc", "is_archive desc,id desc"},
+		{"id", "id", "asc", "id asc,is_archive asc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := orderSignature(questionSortKeys(tt.orderBy, tt.order)); got != tt.want {
+				t.Errorf("questionSortKeys(%q, %q) = %s, want %s", tt.orderBy, tt.order, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 30, 15, 123456789, time.FixedZone("CST", 8*3600))
+	q := database.Question{IsArchive: true, IsPublish: true, Hot: 12.5}
+	q.ID = 42
+	q.CreatedAt = created
+	tests := []struct {
+		name    string
+		orderBy string
+		want    []interface{}
+	}{
+		{"id", "id", []interface{}{uint(42), true}},
+		{"created_at", "created_at", []interface{}{created, true, uint(42)}},
+		{"hot", "hot", []interface{}{12.5, true, uint(42)}},
+		{"is_publish", "is_publish", []interface{}{true, true, uint(42)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := questionSortKeys(tt.orderBy, "desc")
+			cursor, err := encodeCursor(keys, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			values, err := decodeCursor(keys, cursor)
+			if err != nil {
+				t.Fatalf("decodeCursor() = %v", err)
+			}
+			if len(values) != len(tt.want) {
+				t.Fatalf("decodeCursor() = %v, want %v", values, tt.want)
+			}
+			for i, v := range values {
+				if want, ok := tt.want[i].(time.Time); ok {
+					if got, ok := v.(time.Time); !ok || !got.Equal(want) {
+						t.Errorf("value %d = %v, want %v", i, v, want)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(v, tt.want[i]) {
+					t.Errorf("value %d = %#v, want %#v", i, v, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	var q database.Question
+	q.ID = 7
+	keys := questionSortKeys("hot", "desc")
+	cursor, err := encodeCursor(keys, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	tests := []struct {
+		name   string
+		keys   []sortKey
+		cursor string
+	}{
+		{"not base64", keys, "!!!"},
+		{"not json", keys, encode("cursor")},
+		{"other ordering", questionSortKeys("hot", "asc"), cursor},
+		{"other column", questionSortKeys("created_at", "desc"), cursor},
+		{"missing values", keys, encode(`{"o":"hot desc,is_archive asc,id desc","v":[1,false]}`)},
+		{"wrong type", keys, encode(`{"o":"hot desc,is_archive asc,id desc","v":["hot",false,1]}`)},
+		{"negative id", keys, encode(`{"o":"hot desc,is_archive asc,id desc","v":[1,false,-1]}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.keys, tt.cursor); err != errInvalidCursor {
+				t.Errorf("decodeCursor() = %v, want %v", err, errInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []sortKey
+		values   []interface{}
+		want     string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "single key",
+			keys:     []sortKey{{Column: "id", Desc: true}},
+			values:   []interface{}{uint(5)},
+			want:     "(questions.id < ?)",
+			wantArgs: []interface{}{uint(5)},
+		},
+		{
+			name:   "mixed directions",
+			keys:   []sortKey{{Column: "hot", Desc: true}, {Column: "is_archive"}, {Column: "id", Desc: true}},
+			values: []interface{}{1.5, false, uint(9)},
+			want: "(questions.hot < ?) or " +
+				"(questions.hot = ? and questions.is_archive > ?) or " +
+				"(questions.hot = ? and questions.is_archive = ? and questions.id < ?)",
+			wantArgs: []interface{}{1.5, 1.5, false, 1.5, false, uint(9)},
+		},
+		{
+			name:     "ascending",
+			keys:     []sortKey{{Column: "created_at"}, {Column: "id"}},
+			values:   []interface{}{"t", uint(1)},
+			want:     "(questions.created_at > ?) or (questions.created_at = ? and questions.id > ?)",
+			wantArgs: []interface{}{"t", "t", uint(1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args := keysetCondition(tt.keys, tt.values)
+			if got != tt.want {
+				t.Errorf("keysetCondition() = %s, want %s", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("keysetCondition() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const (
+	// drawnTTL forgets a draw session not used for this long
+	drawnTTL = 12 * time.Hour
+	// maxDrawnSessions bounds the sessions kept, as session names come from clients
+	maxDrawnSessions = 100
+)
+
+// drawnSessions remembers the questions already drawn, by draw session.
+type drawnSessions struct {
+	mutex    sync.Mutex
+	sessions map[string]*drawnSet
+}
+
+type drawnSet struct {
+	ids    map[uint]bool
+	usedAt time.Time
+}
+
+func newDrawnSessions() *drawnSessions {
+	return &drawnSessions{sessions: make(map[string]*drawnSet)}
+}
+
+// ids returns the questions drawn in session.
+func (d *drawnSessions) ids(session string) []uint {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.prune(time.Now())
+	set, ok := d.sessions[session]
+	if !ok {
+		return nil
+	}
+	return lo.Keys(set.ids)
+}
+
+// add marks id as drawn in session, it returns false if id was drawn already.
+func (d *drawnSessions) add(session string, id uint) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := time.Now()
+	d.prune(now)
+	set, ok := d.sessions[session]
+	if !ok {
+		if len(d.sessions) >= maxDrawnSessions {
+			d.evictOldest()
+		}
+		set = &drawnSet{ids: make(map[uint]bool)}
+		d.sessions[session] = set
+	}
+	set.usedAt = now
+	if set.ids[id] {
+		return false
+	}
+	set.ids[id] = true
+	return true
+}
+
+// reset forgets the questions drawn in session.
+func (d *drawnSessions) reset(session string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.sessions, session)
+}
+
+func (d *drawnSessions) prune(now time.Time) {
+	for session, set := range d.sessions {
+		if now.Sub(set.usedAt) > drawnTTL {
+			delete(d.sessions, session)
+		}
+	}
+}
+
+func (d *drawnSessions) evictOldest() {
+	var oldest string
+	var oldestAt time.Time
+	for session, set := range d.sessions {
+		if oldest == "" || set.usedAt.Before(oldestAt) {
+			oldest, oldestAt = session, set.usedAt
+		}
+	}
+	delete(d.sessions, oldest)
+}
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"joiask-backend/internal/database"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+type EmojiController struct{}
+
+// emojiCatalog caches the enabled emoji values, it is reloaded after every modification.
+type emojiCatalog struct {
+	mutex   sync.RWMutex
+	loaded  bool
+	enabled map[string]bool
+}
+
+var emojiSet emojiCatalog
+
+func (e *emojiCatalog) valid(c *gin.Context, value string) bool {
+	e.mutex.RLock()
+	loaded := e.loaded
+	e.mutex.RUnlock()
+	if !loaded {
+		var values []string
+		if err := database.DB.Model(&database.Emoji{}).Where("enabled = ?", true).Pluck("value", &values).Error; err != nil {
+			logger(c).Errorf("failed to load emojis: %v", err)
+			return false
+		}
+		enabled := make(map[string]bool, len(values))
+		for _, v := range values {
+			enabled[v] = true
+		}
+		e.mutex.Lock()
+		e.enabled = enabled
+		e.loaded = true
+		e.mutex.Unlock()
+	}
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.enabled[value]
+}
+
+func (e *emojiCatalog) invalidate() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.loaded = false
+}
+
+// Get the emoji catalog, disabled emojis are only listed for admins with all=true
+func (*EmojiController) Get(c *gin.Context) {
+	tx := database.DB.Order("sort_order asc").Order("id asc")
+	if sessions.Default(c).Get("authed") != true || c.Query("all") != "true" {
+		tx = tx.Where("enabled = ?", true)
+	}
+	var list []database.Emoji
+	if err := tx.Find(&list).Error; err != nil {
+		logger(c).Errorf("failed to get emojis: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	Success(c, list)
+}
+
+// Post create an emoji, image emojis are uploaded with the file field
+func (*EmojiController) Post(c *gin.Context) {
+	var emoji database.Emoji
+	emoji.Value = strings.TrimSpace(c.PostForm("value"))
+	emoji.Type = c.PostForm("type")
+	if emoji.Value == "" || len([]rune(emoji.Value)) > 64 {
+		Fail(c, 400, "无效的表情")
+		return
+	}
+	if emoji.Type != database.EmojiTypeUnicode && emoji.Type != database.EmojiTypeImage {
+		Fail(c, 400, "无效的表情类型")
+		return
+	}
+	if !bindEmojiForm(c, &emoji) {
+		return
+	}
+	if emoji.Type == database.EmojiTypeImage && emoji.ImageURL == "" {
+		Fail(c, 400, "请上传表情图片")
+		return
+	}
+	if err := database.DB.Create(&emoji).Error; err != nil {
+		logger(c).Errorf("failed to create emoji: %v", err)
+		Fail(c, 500, "创建表情失败")
+		return
+	}
+	emojiSet.invalidate()
+	Success(c, emoji)
+}
+
+// Put modify an emoji, its value and type can not be changed
+func (*EmojiController) Put(c *gin.Context) {
+	var emoji database.Emoji
+	database.DB.First(&emoji, c.Param("id"))
+	if emoji.ID == 0 {
+		Fail(c, 404, "表情不存在")
+		return
+	}
+	if !bindEmojiForm(c, &emoji) {
+		return
+	}
+	if err := database.DB.Save(&emoji).Error; err != nil {
+		logger(c).Errorf("failed to save emoji: %v", err)
+		Fail(c, 500, "修改表情失败")
+		return
+	}
+	emojiSet.invalidate()
+	Success(c, emoji)
+}
+
+func (*EmojiController) Delete(c *gin.Context) {
+	var emoji database.Emoji
+	database.DB.First(&emoji, c.Param("id"))
+	if emoji.ID == 0 {
+		Fail(c, 404, "表情不存在")
+		return
+	}
+	if err := database.DB.Delete(&emoji).Error; err != nil {
+		logger(c).Errorf("failed to delete emoji: %v", err)
+		Fail(c, 500, "删除表情失败")
+		return
+	}
+	emojiSet.invalidate()
+	Success(c, nil)
+}
+
+// bindEmojiForm applies the editable form fields to emoji and uploads the image
+// if one is provided, it fails the request and returns false on error.
+func bindEmojiForm(c *gin.Context, emoji *database.Emoji) bool {
+	if name, ok := c.GetPostForm("name"); ok {
+		emoji.Name = name
+	}
+	if enabled, ok := c.GetPostForm("enabled"); ok {
+		emoji.Enabled = enabled == "true"
+	}
+	if sortOrder, ok := c.GetPostForm("sort_order"); ok {
+		v, err := strconv.Atoi(sortOrder)
+		if err != nil {
+			Fail(c, 400, "请求错误")
+			return false
+		}
+		emoji.SortOrder = v
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		return true
+	}
+	if emoji.Type != database.EmojiTypeImage {
+		Fail(c, 400, "只有图片表情可以上传图片")
+		return false
+	}
+	url, err := uploadImage(file)
+	if err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "文件上传失败")
+		return false
+	}
+	emoji.ImageURL = url
+	return true
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"joiask-backend/internal/database"
+	"joiask-backend/internal/storage"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct{}
+
+// checkTimeout bounds every readiness check
+const checkTimeout = 3 * time.Second
+
+type CheckResult struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// runCheck runs a check with the timeout, a check that times out keeps running
+// in the background but is reported as failed.
+func runCheck(check func(ctx context.Context) error) CheckResult {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errors.New("timeout")
+	}
+	result := CheckResult{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = "fail"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Healthz reports that the process is alive
+func (*HealthController) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz checks the database and the storage backend, it responds 503 if any
+// check fails
+func (*HealthController) Readyz(c *gin.Context) {
+	checks := map[string]CheckResult{
+		"database": runCheck(func(ctx context.Context) error {
+			db, err := database.DB.DB()
+			if err != nil {
+				return err
+			}
+			return db.PingContext(ctx)
+		}),
+		"storage": runCheck(func(context.Context) error {
+			return storage.Get().Check()
+		}),
+	}
+	status := http.StatusOK
+	for name, result := range checks {
+		if result.Status != "ok" {
+			logger(c).Warnf("readiness check %s failed: %s", name, result.Error)
+			status = http.StatusServiceUnavailable
+		}
+	}
+	overall := "ok"
+	if status != http.StatusOK {
+		overall = "fail"
+	}
+	c.JSON(status, gin.H{"status": overall, "checks": checks})
+}
@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"joiask-backend/internal/database"
+	"joiask-backend/internal/metrics"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+type OnAirController struct{}
+
+type OnAirRequest struct {
+	QuestionID int `json:"question_id" binding:"required"`
+}
+
+// onAirHub holds the overlay clients, which only receive the on-air question
+type onAirHub struct {
+	mutex   sync.Mutex
+	clients map[chan []byte]bool
+	closed  bool
+	// The on-air question id cached from the config, only set changes it
+	idMutex sync.Mutex
+	id      uint
+	loaded  bool
+}
+
+var onAir = onAirHub{clients: make(map[chan []byte]bool)}
+
+func init() {
+	metrics.RegisterClients("onair", func() float64 {
+		onAir.mutex.Lock()
+		defer onAir.mutex.Unlock()
+		return float64(len(onAir.clients))
+	})
+}
+
+// questionID returns the id of the question on air, 0 if there is none
+func (h *onAirHub) questionID() (uint, error) {
+	h.idMutex.Lock()
+	defer h.idMutex.Unlock()
+	if !h.loaded {
+		var config database.Config
+		if err := database.DB.First(&config).Error; err != nil {
+			return 0, err
+		}
+		h.id = config.OnAirQuestionID
+		h.loaded = true
+	}
+	return h.id, nil
+}
+
+// current returns the question on air, or nil if there is none
+func (h *onAirHub) current() (*database.Question, error) {
+	id, err := h.questionID()
+	if err != nil {
+		return nil, err
+	}
+	if id == 0 {
+		return nil, nil
+	}
+	var q database.Question
+	tx := database.DB.Preload(clause.Associations).Where("is_shadow = ?", false).Limit(1).Find(&q, id)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return nil, nil
+	}
+	questionList := []database.Question{q}
+	if err := loadEmojis(questionList); err != nil {
+		return nil, err
+	}
+	return &questionList[0], nil
+}
+
+func (h *onAirHub) payload() ([]byte, error) {
+	q, err := h.current()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(q)
+}
+
+// set puts the question on air, 0 takes it off air
+func (h *onAirHub) set(c *gin.Context, id uint) error {
+	var config database.Config
+	if err := database.DB.First(&config).Error; err != nil {
+		return err
+	}
+	// Only the column, so a concurrent config change is not overwritten
+	err := database.DB.Model(&database.Config{}).Where("id = ?", config.ID).Update("on_air_question_id", id).Error
+	if err != nil {
+		return err
+	}
+	h.idMutex.Lock()
+	h.id = id
+	h.loaded = true
+	h.idMutex.Unlock()
+	h.publish(c)
+	return nil
+}
+
+// publish sends the current state to every overlay client
+func (h *onAirHub) publish(c *gin.Context) {
+	data, err := h.payload()
+	if err != nil {
+		logger(c).Error("Failed to load on-air question:", err)
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for client := range h.clients {
+		select {
+		case client <- data:
+		default:
+			metrics.ClientsDropped.WithLabelValues("onair").Inc()
+			delete(h.clients, client)
+			close(client)
+		}
+	}
+}
+
+// refresh republishes if the question is on air, after it was changed
+func (h *onAirHub) refresh(c *gin.Context, id uint) {
+	if current, err := h.questionID(); err == nil && current == id {
+		h.publish(c)
+	}
+}
+
+// clear takes the question off air if it is on air, after it was removed
+func (h *onAirHub) clear(c *gin.Context, id uint) {
+	if current, err := h.questionID(); err == nil && current == id {
+		if err := h.set(c, 0); err != nil {
+			logger(c).Error("Failed to clear on-air question:", err)
+		}
+	}
+}
+
+// shutdown disconnects every overlay client and refuses new ones
+func (h *onAirHub) shutdown() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.closed = true
+	for client := range h.clients {
+		delete(h.clients, client)
+		close(client)
+	}
+}
+
+// Shutdown disconnects the overlay clients, they reconnect after a retry hint
+func (*OnAirController) Shutdown() {
+	onAir.shutdown()
+}
+
+func (*OnAirController) Get(c *gin.Context) {
+	q, err := onAir.current()
+	if err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "获取直播提问失败")
+		return
+	}
+	Success(c, q)
+}
+
+func (*OnAirController) Put(c *gin.Context) {
+	var request OnAirRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		Fail(c, 400, "请求错误")
+		return
+	}
+	var q database.Question
+	if database.DB.Where("is_shadow = ?", false).Limit(1).Find(&q, request.QuestionID).RowsAffected == 0 {
+		Fail(c, 404, "提问不存在")
+		return
+	}
+	if err := onAir.set(c, q.ID); err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "设置直播提问失败")
+		return
+	}
+	Success(c, nil)
+}
+
+func (*OnAirController) Delete(c *gin.Context) {
+	if err := onAir.set(c, 0); err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "取消直播提问失败")
+		return
+	}
+	Success(c, nil)
+}
+
+// SSE streams the on-air question to overlays such as an OBS browser source,
+// every event carries the whole question or null when nothing is on air
+func (*OnAirController) SSE(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("X-Accel-Buffering", "no")
+
+	clientChan := make(chan []byte, 16)
+	onAir.mutex.Lock()
+	if onAir.closed {
+		onAir.mutex.Unlock()
+		c.Stream(func(w io.Writer) bool {
+			encodeRetry(w)
+			return false
+		})
+		return
+	}
+	onAir.clients[clientChan] = true
+	onAir.mutex.Unlock()
+	defer func() {
+		onAir.mutex.Lock()
+		if onAir.clients[clientChan] {
+			delete(onAir.clients, clientChan)
+			close(clientChan)
+		}
+		onAir.mutex.Unlock()
+	}()
+
+	clientGone := c.Writer.CloseNotify()
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	messageID := 0
+	send := func(w io.Writer, data []byte) bool {
+		err := sse.Encode(w, sse.Event{
+			Id:    fmt.Sprintf("%d", messageID),
+			Event: "onair",
+			Data:  string(data),
+		})
+		if err != nil {
+			logger(c).Error("Failed to encode on-air event:", err)
+			return false
+		}
+		messageID++
+		return true
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		// Send the current state first so a reloaded overlay is never empty
+		if messageID == 0 {
+			data, err := onAir.payload()
+			if err != nil {
+				logger(c).Error("Failed to load on-air question:", err)
+				return false
+			}
+			return send(w, data)
+		}
+		select {
+		case <-clientGone:
+			return false
+		case <-heartbeat.C:
+			err := sse.Encode(w, sse.Event{
+				Event: "heartbeat",
+				Data:  "heartbeat",
+			})
+			if err != nil {
+				logger(c).Error("Failed to encode heartbeat event:", err)
+				return false
+			}
+			return true
+		case data, ok := <-clientChan:
+			if !ok {
+				// Dropped or shutting down, ask the overlay to reconnect
+				if err := encodeRetry(w); err != nil {
+					logger(c).Error("Failed to encode retry event:", err)
+				}
+				return false
+			}
+			return send(w, data)
+		}
+	})
+}
@@ -3,35 +3,55 @@ package controller
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"joiask-backend/internal/database"
+	"joiask-backend/internal/metrics"
+	"joiask-backend/internal/pow"
+	"joiask-backend/internal/search"
 	"joiask-backend/internal/storage"
 	"joiask-backend/pkg/util"
+	"math/rand"
+	"mime/multipart"
 	"net/http"
 	"path"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
 // 1 for emoji op
 // 2 for archive op
 // 3 for cursor op
+// 4 for draw op
+// 5 for tag merge op
 const (
 	SSEventEmoji = iota + 1
 	SSEventArchive
 	SSEventCursor
+	SSEventDraw
+	SSEventTagMerge
 )
 
+// eventNames label events in metrics
+var eventNames = map[int]string{
+	SSEventEmoji:    "emoji",
+	SSEventArchive:  "archive",
+	SSEventCursor:   "cursor",
+	SSEventDraw:     "draw",
+	SSEventTagMerge: "tag_merge",
+}
+
 type SSEvent struct {
 	Type int
 	Data any
@@ -49,6 +69,10 @@ type QuestionController struct {
 	// WebSocket clients
 	wsClients      map[*websocket.Conn]bool
 	wsClientsMutex sync.Mutex
+	// Questions already drawn, by draw session
+	drawn *drawnSessions
+	// Closed on shutdown, stops the broadcast and refuses new clients
+	done chan struct{}
 }
 
 var wsUpgrader = websocket.Upgrader{
@@ -62,14 +86,85 @@ func NewQuestionController() *QuestionController {
 		eventChan: make(chan SSEvent),
 		clients:   make(map[chan SSEvent]bool),
 		wsClients: make(map[*websocket.Conn]bool),
+		drawn:     newDrawnSessions(),
+		done:      make(chan struct{}),
 	}
+	metrics.RegisterClients("sse", func() float64 {
+		controller.clientsMutex.Lock()
+		defer controller.clientsMutex.Unlock()
+		return float64(len(controller.clients))
+	})
+	metrics.RegisterClients("ws", func() float64 {
+		controller.wsClientsMutex.Lock()
+		defer controller.wsClientsMutex.Unlock()
+		return float64(len(controller.wsClients))
+	})
 	// Start broadcast goroutine
 	go controller.broadcast()
 	return controller
 }
 
+// Publish sends an event to every connected client, events published after
+// shutdown are dropped.
+func (this *QuestionController) Publish(event SSEvent) {
+	select {
+	case this.eventChan <- event:
+	case <-this.done:
+	}
+}
+
+// closing reports whether the controller is shutting down
+func (this *QuestionController) closing() bool {
+	select {
+	case <-this.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown stops the broadcast and disconnects every realtime client, SSE
+// clients get a retry hint and WebSocket clients a close frame so they
+// reconnect once the server is back.
+func (this *QuestionController) Shutdown() {
+	close(this.done)
+
+	this.clientsMutex.Lock()
+	for client := range this.clients {
+		delete(this.clients, client)
+		close(client)
+	}
+	this.clientsMutex.Unlock()
+
+	this.wsClientsMutex.Lock()
+	message := websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting")
+	for client := range this.wsClients {
+		client.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		client.Close()
+		delete(this.wsClients, client)
+	}
+	this.wsClientsMutex.Unlock()
+}
+
+// encodeRetry tells an SSE client to reconnect after a random delay, so the
+// clients of a restarting server do not all come back at once.
+func encodeRetry(w io.Writer) error {
+	return sse.Encode(w, sse.Event{
+		Event: "retry",
+		Data:  "retry",
+		Retry: uint(1000 + rand.Intn(4000)),
+	})
+}
+
 func (this *QuestionController) broadcast() {
-	for event := range this.eventChan {
+	for {
+		var event SSEvent
+		select {
+		case event = <-this.eventChan:
+		case <-this.done:
+			return
+		}
+		metrics.EventsBroadcast.WithLabelValues(eventNames[event.Type]).Inc()
 		// Broadcast to SSE clients
 		this.clientsMutex.Lock()
 		for client := range this.clients {
@@ -77,6 +172,7 @@ func (this *QuestionController) broadcast() {
 			case client <- event:
 			default:
 				// Remove client if channel is full
+				metrics.ClientsDropped.WithLabelValues("sse").Inc()
 				delete(this.clients, client)
 				close(client)
 			}
@@ -95,6 +191,7 @@ func (this *QuestionController) broadcast() {
 			err := client.WriteMessage(websocket.TextMessage, eventJson)
 			if err != nil {
 				log.Error("Failed to send WebSocket message:", err)
+				metrics.ClientsDropped.WithLabelValues("ws").Inc()
 				client.Close()
 				delete(this.wsClients, client)
 			}
@@ -114,6 +211,19 @@ type QuestionRequest struct {
 	Rainbow  bool   `form:"rainbow"`
 	Archive  bool   `form:"archive"`
 	Publish  bool   `form:"publish"`
+	Shadow   bool   `form:"shadow"`
+	Cursor   string `form:"cursor"`
+	// Filters for moderation, times are RFC3339 or dates in local time
+	CreatedAfter  string   `form:"created_after"`
+	CreatedBefore string   `form:"created_before"`
+	UpdatedAfter  string   `form:"updated_after"`
+	UpdatedBefore string   `form:"updated_before"`
+	HasImages     bool     `form:"has_images"`
+	MinReactions  int      `form:"min_reactions"`
+	Emoji         string   `form:"emoji"`
+	TagIDs        []string `form:"tag_ids"`
+	ExcludeIDs    []string `form:"exclude_ids"`
+	SessionID     int      `form:"session_id"`
 }
 
 type QuestionModifyRequest struct {
@@ -137,17 +247,93 @@ func (*QuestionController) Get(c *gin.Context) {
 		Fail(c, 400, "请求错误")
 		return
 	}
-	var tx = database.DB.Model(&database.Question{}).Preload(clause.Associations).Order(getOrderBy(request.OrderBy) + " " + getOrder(request.Order))
-	if getOrderBy(request.OrderBy) != "is_archive" {
-		tx = tx.Order("is_archive asc")
+	var tx = database.DB.Model(&database.Question{}).Preload(clause.Associations)
+	_, searching := c.GetQuery("search")
+	relevance := ""
+	if searching {
+		tx, relevance = search.Get().Match(tx, request.Search)
+	}
+	ranked := relevance != "" && (request.OrderBy == "" || request.OrderBy == "relevance")
+	keys := questionSortKeys(request.OrderBy, request.Order)
+	if ranked {
+		tx = tx.Order(relevance).Order("is_archive asc")
+	} else {
+		for _, k := range keys {
+			tx = tx.Order(k.String())
+		}
+	}
+	_, useCursor := c.GetQuery("cursor")
+	if useCursor && ranked {
+		Fail(c, 400, "按相关度排序时不支持游标分页")
+		return
+	}
+	// The total is counted by default for page based requests only
+	withTotal := !useCursor
+	if v, ok := c.GetQuery("with_total"); ok {
+		withTotal = v == "true"
 	}
 	if _, ok := c.GetQuery("tag_id"); ok {
 		if request.TagID > 0 {
 			tx = tx.Where("tag_id = ?", request.TagID)
 		}
 	}
-	if _, ok := c.GetQuery("search"); ok {
-		tx = tx.Where("content like ?", "%"+request.Search+"%")
+	if _, ok := c.GetQuery("session_id"); ok {
+		// 0 selects the questions outside of any session
+		tx = tx.Where("questions.session_id = ?", request.SessionID)
+	}
+	if len(request.TagIDs) > 0 {
+		tagIDs, err := parseIDs(request.TagIDs)
+		if err != nil {
+			Fail(c, 400, "请求错误")
+			return
+		}
+		if len(tagIDs) > 0 {
+			tx = tx.Where("questions.tag_id in ?", tagIDs)
+		}
+	}
+	if len(request.ExcludeIDs) > 0 {
+		excludeIDs, err := parseIDs(request.ExcludeIDs)
+		if err != nil {
+			Fail(c, 400, "请求错误")
+			return
+		}
+		if len(excludeIDs) > 0 {
+			tx = tx.Where("questions.id not in ?", excludeIDs)
+		}
+	}
+	for _, f := range []struct {
+		value     string
+		condition string
+		endOfDay  bool
+	}{
+		{request.CreatedAfter, "questions.created_at >= ?", false},
+		{request.CreatedBefore, "questions.created_at < ?", true},
+		{request.UpdatedAfter, "questions.updated_at >= ?", false},
+		{request.UpdatedBefore, "questions.updated_at < ?", true},
+	} {
+		if f.value == "" {
+			continue
+		}
+		t, err := parseTime(f.value, f.endOfDay)
+		if err != nil {
+			Fail(c, 400, "无效的时间")
+			return
+		}
+		tx = tx.Where(f.condition, t)
+	}
+	if _, ok := c.GetQuery("has_images"); ok {
+		if request.HasImages {
+			tx = tx.Where("questions.images_num > 0")
+		} else {
+			tx = tx.Where("questions.images_num = 0")
+		}
+	}
+	if request.MinReactions > 0 {
+		tx = tx.Where("questions.likes >= ?", request.MinReactions)
+	}
+	if request.Emoji != "" {
+		tx = tx.Where("questions.id in (?)", database.DB.Model(&database.EmojiCount{}).
+			Select("question_id").Where("emoji = ? and count > 0", request.Emoji))
 	}
 	if _, ok := c.GetQuery("hide"); ok {
 		tx = tx.Where("is_hide = ?", request.Hide)
@@ -158,9 +344,15 @@ func (*QuestionController) Get(c *gin.Context) {
 	if _, ok := c.GetQuery("archive"); ok {
 		tx = tx.Where("is_archive = ?", request.Archive)
 	}
+	if _, ok := c.GetQuery("shadow"); ok && c.GetBool("authed") {
+		tx = tx.Where("is_shadow = ?", request.Shadow)
+	} else {
+		// Shadow-banned submissions never show up in the normal queue
+		tx = tx.Where("is_shadow = ?", false)
+	}
 	if _, ok := c.GetQuery("publish"); ok {
 		// Normal users can only see published questions
-		log.Debug("publish: ", request.Publish)
+		logger(c).Debug("publish: ", request.Publish)
 		if !c.GetBool("authed") {
 			tx = tx.Where("is_publish = ?", true)
 		} else {
@@ -172,20 +364,244 @@ func (*QuestionController) Get(c *gin.Context) {
 			tx = tx.Where("is_publish = ?", true)
 		}
 	}
-	err := tx.Count(&total).Scopes(paginate(getPage(request.Page), getPageSize(request.PageSize))).Find(&questionList).Error
+	if withTotal {
+		if err := tx.Count(&total).Error; err != nil {
+			logger(c).Error(err)
+			Fail(c, 500, "获取提问失败")
+			return
+		}
+	}
+	pageSize := getPageSize(request.PageSize)
+	var err error
+	if useCursor {
+		if request.Cursor != "" {
+			values, err := decodeCursor(keys, request.Cursor)
+			if err != nil {
+				Fail(c, 400, "无效的游标")
+				return
+			}
+			condition, args := keysetCondition(keys, values)
+			tx = tx.Where(condition, args...)
+		}
+		// Fetch one more row to know whether there is a next page
+		err = tx.Limit(pageSize + 1).Find(&questionList).Error
+	} else {
+		err = tx.Scopes(paginate(getPage(request.Page), pageSize)).Find(&questionList).Error
+	}
+	nextCursor := ""
+	if err == nil && useCursor && len(questionList) > pageSize {
+		questionList = questionList[:pageSize]
+		nextCursor, err = encodeCursor(keys, questionList[pageSize-1])
+	}
+	if err == nil {
+		err = loadEmojis(questionList)
+	}
+	if err == nil && searching {
+		err = loadSnippets(request.Search, questionList)
+	}
 	if err != nil {
-		log.Error(err)
+		logger(c).Error(err)
 		Fail(c, 500, "获取提问失败")
 		return
 	}
-	Success(c, gin.H{
+	response := gin.H{
 		"questions": questionList,
-		"total":     total,
-		"page":      getPage(request.Page),
-		"page_size": getPageSize(request.PageSize),
+		"page_size": pageSize,
+	}
+	if useCursor {
+		response["next_cursor"] = nextCursor
+	} else {
+		response["page"] = getPage(request.Page)
+	}
+	if withTotal {
+		response["total"] = total
+	}
+	Success(c, response)
+}
+
+// GetOne returns a single question by its public id, with the same visibility
+// rules as the list: the public only sees published questions.
+func (*QuestionController) GetOne(c *gin.Context) {
+	id, err := database.DecodePublicID(c.Param("id"))
+	if err != nil {
+		Fail(c, 404, "提问不存在")
+		return
+	}
+	tx := database.DB.Preload(clause.Associations).Where("id = ?", id)
+	if sessions.Default(c).Get("authed") != true {
+		tx = tx.Where("is_publish = ? and is_shadow = ?", true, false)
+	}
+	var q database.Question
+	if err := tx.Limit(1).Find(&q).Error; err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "获取提问失败")
+		return
+	}
+	if q.ID == 0 {
+		Fail(c, 404, "提问不存在")
+		return
+	}
+	questionList := []database.Question{q}
+	if err := loadEmojis(questionList); err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "获取提问失败")
+		return
+	}
+	Success(c, questionList[0])
+}
+
+type TrendingRequest struct {
+	Limit int `form:"limit"`
+	TagID int `form:"tag_id"`
+}
+
+// Trending returns the published questions with the highest hot score
+func (*QuestionController) Trending(c *gin.Context) {
+	var request TrendingRequest
+	if err := c.Bind(&request); err != nil {
+		Fail(c, 400, "请求错误")
+		return
+	}
+	if request.Limit <= 0 {
+		request.Limit = 10
+	}
+	if request.Limit > 50 {
+		request.Limit = 50
+	}
+	tx := database.DB.Model(&database.Question{}).Preload(clause.Associations).
+		Where("is_publish = ? and is_archive = ? and is_shadow = ?", true, false, false).
+		Order("hot desc").Limit(request.Limit)
+	if request.TagID > 0 {
+		tx = tx.Where("tag_id = ?", request.TagID)
+	}
+	var questionList []database.Question
+	err := tx.Find(&questionList).Error
+	if err == nil {
+		err = loadEmojis(questionList)
+	}
+	if err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "获取提问失败")
+		return
+	}
+	Success(c, questionList)
+}
+
+type DrawRequest struct {
+	TagID   int   `json:"tag_id"`
+	Publish *bool `json:"publish"`
+	// Weight is empty for uniform, "reactions" or "age"
+	Weight string `json:"weight"`
+	// Session groups draws that should not repeat, defaults to the admin
+	Session   string `json:"session"`
+	Broadcast bool   `json:"broadcast"`
+}
+
+func drawSession(c *gin.Context, session string) string {
+	if session != "" {
+		return session
+	}
+	return "admin:" + strconv.Itoa(int(c.MustGet("user").(database.Admin).ID))
+}
+
+// Draw picks a random unarchived question that was not drawn in the session yet
+func (this *QuestionController) Draw(c *gin.Context) {
+	var request DrawRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		Fail(c, 400, "请求错误")
+		return
+	}
+	if request.Weight != "" && request.Weight != "reactions" && request.Weight != "age" {
+		Fail(c, 400, "无效的权重")
+		return
+	}
+	session := drawSession(c, request.Session)
+	drawn := this.drawn.ids(session)
+	tx := database.DB.Model(&database.Question{}).Select("id, likes, created_at").
+		Where("is_archive = ? and is_shadow = ?", false, false)
+	if request.TagID > 0 {
+		tx = tx.Where("tag_id = ?", request.TagID)
+	}
+	if request.Publish != nil {
+		tx = tx.Where("is_publish = ?", *request.Publish)
+	}
+	if len(drawn) > 0 {
+		tx = tx.Where("id not in ?", drawn)
+	}
+	var candidates []database.Question
+	if err := tx.Find(&candidates).Error; err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "抽取提问失败")
+		return
+	}
+	if len(candidates) == 0 {
+		Fail(c, 404, "没有可以抽取的提问")
+		return
+	}
+	now := time.Now()
+	weights := make([]float64, len(candidates))
+	sum := 0.0
+	for i, q := range candidates {
+		switch request.Weight {
+		case "reactions":
+			weights[i] = 1 + float64(q.Likes)
+		case "age":
+			// Questions waiting longer are more likely to be drawn
+			weights[i] = 1 + now.Sub(q.CreatedAt).Hours()
+		default:
+			weights[i] = 1
+		}
+		sum += weights[i]
+	}
+	picked := candidates[len(candidates)-1].ID
+	r := rand.Float64() * sum
+	for i, w := range weights {
+		if r < w {
+			picked = candidates[i].ID
+			break
+		}
+		r -= w
+	}
+	var q database.Question
+	if err := database.DB.Preload(clause.Associations).First(&q, picked).Error; err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "抽取提问失败")
+		return
+	}
+	questionList := []database.Question{q}
+	if err := loadEmojis(questionList); err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "抽取提问失败")
+		return
+	}
+	q = questionList[0]
+	// A concurrent draw in the same session may have picked it meanwhile
+	if !this.drawn.add(session, q.ID) {
+		Fail(c, 409, "抽取冲突，请重试")
+		return
+	}
+	// Unpublished questions are never shown to the audience
+	broadcast := request.Broadcast && q.IsPublish
+	if broadcast {
+		this.Publish(SSEvent{
+			Type: SSEventDraw,
+			Data: q,
+		})
+	}
+	Success(c, gin.H{
+		"question":  q,
+		"remaining": len(candidates) - 1,
+		"broadcast": broadcast,
 	})
 }
 
+// ResetDraw forgets the questions drawn in a session
+func (this *QuestionController) ResetDraw(c *gin.Context) {
+	session := drawSession(c, c.Query("session"))
+	this.drawn.reset(session)
+	Success(c, nil)
+}
+
 func (this *QuestionController) Put(c *gin.Context) {
 	var request QuestionModifyRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -202,25 +618,46 @@ func (this *QuestionController) Put(c *gin.Context) {
 		Fail(c, 400, "请求错误")
 		return
 	}
+	now := time.Now()
+	if request.IsPublish != q.IsPublish {
+		q.PublishedAt = nil
+		if request.IsPublish {
+			q.PublishedAt = &now
+		}
+	}
+	if request.IsArchive != q.IsArchive {
+		q.ArchivedAt = nil
+		if request.IsArchive {
+			q.ArchivedAt = &now
+		}
+	}
 	q.TagID = request.TagID
 	q.IsHide = request.IsHide
 	q.IsRainbow = request.IsRainbow
 	q.IsArchive = request.IsArchive
 	q.IsPublish = request.IsPublish
-	err := database.DB.Save(&q).Error
+	// Only the edited columns, so reactions and moderation written since the
+	// question was read are kept
+	err := database.DB.Model(&q).
+		Select("tag_id", "is_hide", "is_rainbow", "is_archive", "is_publish", "published_at", "archived_at", "updated_at").
+		Updates(&q).Error
 	if err != nil {
-		log.Error(err)
+		logger(c).Error(err)
 		Fail(c, 500, "修改提问失败")
 		return
 	}
-	this.eventChan <- SSEvent{
+	this.Publish(SSEvent{
 		Type: SSEventArchive,
 		Data: q.ID,
-	}
+	})
+	onAir.refresh(c, q.ID)
 	Success(c, nil)
 }
 
 func (*QuestionController) Post(c *gin.Context) {
+	if checkBan(c) {
+		return
+	}
 	var tag database.Tag
 	tagID := c.PostForm("tag_id")
 	database.DB.First(&tag, tagID)
@@ -228,29 +665,56 @@ func (*QuestionController) Post(c *gin.Context) {
 		Fail(c, 404, "话题不存在")
 		return
 	}
+	if checkWindow(c, tag) {
+		return
+	}
+	content := strings.Trim(c.PostForm("content"), " \r\n\t")
+	var files []*multipart.FileHeader
+	if mp, err := c.MultipartForm(); err == nil {
+		files = mp.File["files[]"]
+	}
+	if tag.Settings.MaxContentLength > 0 && utf8.RuneCountInString(content) > tag.Settings.MaxContentLength {
+		Fail(c, 400, fmt.Sprintf("提问内容不能超过 %d 字", tag.Settings.MaxContentLength))
+		return
+	}
+	if len(files) > 0 && tag.Settings.ImagesDisabled {
+		Fail(c, 400, "该话题不允许上传图片")
+		return
+	}
+	if tag.Settings.MaxImages > 0 && len(files) > tag.Settings.MaxImages {
+		Fail(c, 400, fmt.Sprintf("最多只能上传 %d 张图片", tag.Settings.MaxImages))
+		return
+	}
+	token := c.PostForm("pow_challenge")
+	if err := pow.Get().Verify(token, c.PostForm("pow_nonce")); err != nil {
+		logger(c).Debug("pow verification failed: ", err)
+		Fail(c, 429, "人机验证失败，请重试")
+		return
+	}
 	var q database.Question
 	q.TagID = int(tag.ID)
-	q.Content = strings.Trim(c.PostForm("content"), " \r\n\t")
+	q.Content = content
 	q.IsHide = c.PostForm("hide") == "true"
 	q.IsRainbow = c.PostForm("rainbow") == "true"
-	mp, _ := c.MultipartForm()
-	for _, v := range mp.File["files[]"] {
-		f, err := v.Open()
-		if err != nil {
-			log.Error(err)
-			Fail(c, 405, "文件上传失败")
-			return
-		}
-		fileContent, err := io.ReadAll(f)
-		if err != nil {
-			log.Error(err)
-			Fail(c, 405, "文件上传失败")
-			return
-		}
-		newFileName := util.Md5v(string(fileContent)) + path.Ext(v.Filename)
-		url, err := storage.Get().Upload(newFileName, bytes.NewReader(fileContent))
+	q.IsPublish = tag.Settings.AutoPublish
+	if q.IsPublish {
+		now := time.Now()
+		q.PublishedAt = &now
+	}
+	q.SubmitterHash = hashIP(c.ClientIP())
+	q.SubmitterVisitor = hashIP(visitorID(c))
+	q.IsShadow = isShadowBanned(c, q.SubmitterHash, q.SubmitterVisitor)
+	session, err := database.OpenSession(q.TagID, time.Now())
+	if err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "创建提问失败")
+		return
+	}
+	q.SessionID = int(session.ID)
+	for _, v := range files {
+		url, err := uploadImage(v)
 		if err != nil {
-			log.Error(err)
+			logger(c).Error(err)
 			Fail(c, 500, "文件上传失败")
 			return
 		}
@@ -261,40 +725,73 @@ func (*QuestionController) Post(c *gin.Context) {
 			q.Images += ";" + url
 		}
 	}
-	err := database.DB.Save(&q).Error
+	// The token is used up only together with a stored question, so a failed
+	// save can be retried with the same solution
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&q).Error; err != nil {
+			return err
+		}
+		return pow.Get().Redeem(token)
+	})
+	if errors.Is(err, pow.ErrReplayed) {
+		Fail(c, 429, "人机验证失败，请重试")
+		return
+	}
 	if err != nil {
-		log.Error(err)
+		logger(c).Error(err)
 		Fail(c, 500, "创建提问失败")
 		return
 	}
+	pow.Get().Record()
 	Success(c, nil)
 }
 
+// uploadImage stores an uploaded file under its content hash and returns the url
+func uploadImage(v *multipart.FileHeader) (string, error) {
+	f, err := v.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fileContent, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	newFileName := util.Md5v(string(fileContent)) + path.Ext(v.Filename)
+	return storage.Get().Upload(newFileName, bytes.NewReader(fileContent))
+}
+
 func (*QuestionController) Delete(c *gin.Context) {
 	var q database.Question
 	id := c.Param("id")
 	err := database.DB.First(&q, id).Error
 	if q.ID == 0 {
-		log.Error(err)
+		logger(c).Error(err)
 		Fail(c, 404, "提问不存在")
 		return
 	}
 	tx := database.DB.Begin()
 	tx.Delete(&database.LikeRecord{}, "question_id", q.ID)
+	tx.Delete(&database.Reaction{}, "question_id", q.ID)
+	tx.Delete(&database.EmojiCount{}, "question_id", q.ID)
 	tx.Delete(&q)
 	if tx.Error != nil {
-		log.Error(err)
+		logger(c).Error(err)
 		Fail(c, 500, "删除提问失败")
 		tx.Rollback()
 		return
 	}
 	tx.Commit()
-	// clean images in storage
+	deleteImages(c, q.Images)
+	onAir.clear(c, q.ID)
+	Success(c, nil)
+}
+
+// deleteImages cleans images of a deleted question in storage
+func deleteImages(c *gin.Context, images string) {
 	key := "upload-img/"
-	images := strings.Split(q.Images, ";")
 	filenames := []string{}
-	for i := range images {
-		cur := images[i]
+	for _, cur := range strings.Split(images, ";") {
 		parts := strings.SplitN(cur, key, 2)
 		if len(parts) < 2 {
 			continue
@@ -303,9 +800,10 @@ func (*QuestionController) Delete(c *gin.Context) {
 	}
 	// it's ok to fail deleting
 	for _, f := range filenames {
-		_ = storage.Get().Delete(f)
+		if err := storage.Get().Delete(f); err != nil {
+			logger(c).Warnf("failed to delete image %s: %v", f, err)
+		}
 	}
-	Success(c, nil)
 }
 
 type EmojiRecord struct {
@@ -313,116 +811,195 @@ type EmojiRecord struct {
 	Count int    `json:"count"`
 }
 
-var EmojiValid = map[string]bool{
-	"👍": true,
-	"👎": true,
-	"🤣": true,
-	"😭": true,
-	"😓": true,
-	"😬": true,
-	"🥳": true,
-	"😨": true,
-	"😠": true,
-	"💩": true,
-	"💖": true,
-	"🐵": true,
-	"❓": true,
-	"🫂": true,
-	"🔘": true,
-	"👅": true,
-	"🥺": true,
-	"👻": true,
-	"😅": true,
-	"🌹": true,
-}
-
+// Emoji toggles an emoji reaction of the visitor on a question, each visitor
+// holds at most one of each emoji per question.
 func (this *QuestionController) Emoji(c *gin.Context) {
+	if checkBan(c) {
+		return
+	}
 	emojiToAdd := c.PostForm("emoji")
-	// should check emojiToAdd valid or not
-	if !EmojiValid[emojiToAdd] {
+	if emojiToAdd == "" {
 		Fail(c, 400, "无效的表情符号")
 		return
 	}
-	// ip := c.ClientIP()
 	id, _ := strconv.Atoi(c.Param("id"))
-	// var lr database.LikeRecord
-	// database.DB.Where("ip = ? and question_id = ?", ip, id).First(&lr)
-	// if lr.ID > 0 {
-	// 	Fail(c, 400, "您已经评价过了")
-	// 	return
-	// }
-	// lr.IP = ip
-	// lr.QuestionID = id
-	// tx := database.DB.Begin()
-	// err := tx.Create(&lr).Error
-	// if err != nil {
-	// 	log.Error(err)
-	// 	Fail(c, 500, "评价失败")
-	// 	tx.Rollback()
-	// 	return
-	// }
-	tx := database.DB.Begin()
-	var q database.Question
-	err := database.DB.Where("id = ?", id).First(&q).Error
-	if err != nil {
-		log.Error(err)
+	visitor := visitorHash(c)
+	// Same visibility as GetOne, so hidden questions can not be found by id
+	exists := database.DB.Model(&database.Question{}).Where("id = ?", id)
+	if sessions.Default(c).Get("authed") != true {
+		exists = exists.Where("is_publish = ? and is_shadow = ?", true, false)
+	}
+	var count int64
+	if err := exists.Count(&count).Error; err != nil {
+		logger(c).Error(err)
 		Fail(c, 500, "评价失败")
-		tx.Rollback()
 		return
 	}
-	var emojis []*EmojiRecord
-	if len(q.Emojis) > 0 {
-		err = json.Unmarshal([]byte(q.Emojis), &emojis)
-		if err != nil {
-			log.Error((err))
-			Fail(c, 500, "解析表情失败")
+	if count == 0 {
+		Fail(c, 404, "提问不存在")
+		return
+	}
+	tx := database.DB.Begin()
+	var reaction database.Reaction
+	err := tx.Where("question_id = ? and visitor = ? and emoji = ?", id, visitor, emojiToAdd).Limit(1).Find(&reaction).Error
+	if err == nil {
+		if reaction.ID > 0 {
+			// Clicking again removes the reaction
+			err = tx.Delete(&reaction).Error
+			if err == nil {
+				err = addEmojiCount(tx, id, emojiToAdd, -1)
+			}
+			if err == nil {
+				err = database.AddReactionScore(tx, id, -1, reaction.CreatedAt)
+			}
+		} else if !emojiSet.valid(c, emojiToAdd) {
+			// Only checked when adding, so reactions with a disabled emoji can still be removed
 			tx.Rollback()
+			Fail(c, 400, "无效的表情符号")
 			return
+		} else {
+			reaction = database.Reaction{
+				QuestionID: id,
+				Visitor:    visitor,
+				Emoji:      emojiToAdd,
+			}
+			err = tx.Create(&reaction).Error
+			if err == nil {
+				err = addEmojiCount(tx, id, emojiToAdd, 1)
+			}
+			if err == nil {
+				err = database.AddReactionScore(tx, id, 1, reaction.CreatedAt)
+			}
 		}
 	}
-	added := false
-	for _, e := range emojis {
-		if e.Value == emojiToAdd {
-			added = true
-			e.Count++
-			break
-		}
-	}
-	if !added {
-		emojis = append(emojis, &EmojiRecord{
-			Value: emojiToAdd,
-			Count: 1,
-		})
-	}
-	updatedList, err := json.Marshal(emojis)
 	if err != nil {
-		log.Error(err)
+		logger(c).Error(err)
 		Fail(c, 500, "评价失败")
 		tx.Rollback()
 		return
 	}
-	q.Emojis = string(updatedList)
-	err = tx.Save(&q).Error
+	emojis, err := emojiRecords(tx, id)
 	if err != nil {
-		log.Error(err)
+		logger(c).Error(err)
 		Fail(c, 500, "评价失败")
 		tx.Rollback()
 		return
 	}
-	if tx.Commit().Error != nil {
-		log.Error(err)
+	var mine []string
+	err = tx.Model(&database.Reaction{}).Where("question_id = ? and visitor = ?", id, visitor).Pluck("emoji", &mine).Error
+	if err != nil {
+		logger(c).Error(err)
 		Fail(c, 500, "评价失败")
 		tx.Rollback()
 		return
 	}
-	this.eventChan <- SSEvent{
+	if err = tx.Commit().Error; err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "评价失败")
+		return
+	}
+	this.Publish(SSEvent{
 		Type: SSEventEmoji,
 		Data: EmojiRecords{
 			CardID: id,
 			Emojis: emojis,
 		},
+	})
+	onAir.refresh(c, uint(id))
+	Success(c, gin.H{
+		"emojis": emojis,
+		"mine":   mine,
+	})
+}
+
+// addEmojiCount atomically adds delta to the count of emoji on a question,
+// counters reaching zero are removed.
+func addEmojiCount(tx *gorm.DB, questionID int, emoji string, delta int) error {
+	count := gorm.Expr("? + ?", clause.Column{Name: "count"}, delta)
+	if delta > 0 {
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "question_id"}, {Name: "emoji"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"count": count}),
+		}).Create(&database.EmojiCount{
+			QuestionID: questionID,
+			Emoji:      emoji,
+			Count:      delta,
+		}).Error
 	}
-	Success(c, nil)
+	err := tx.Model(&database.EmojiCount{}).
+		Where("question_id = ? and emoji = ?", questionID, emoji).
+		Update("count", count).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("question_id = ? and count <= 0", questionID).Delete(&database.EmojiCount{}).Error
+}
+
+// emojiRecords returns the emoji counters of a question.
+func emojiRecords(tx *gorm.DB, questionID int) ([]*EmojiRecord, error) {
+	var counts []database.EmojiCount
+	err := tx.Where("question_id = ?", questionID).Order("count desc").Order("emoji").Find(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	emojis := make([]*EmojiRecord, 0, len(counts))
+	for _, e := range counts {
+		emojis = append(emojis, &EmojiRecord{Value: e.Emoji, Count: e.Count})
+	}
+	return emojis, nil
+}
+
+// loadSnippets fills Question.Snippet with the highlighted search matches.
+func loadSnippets(query string, questions []database.Question) error {
+	if len(questions) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(questions))
+	for _, q := range questions {
+		ids = append(ids, q.ID)
+	}
+	snippets, err := search.Get().Snippets(query, ids)
+	if err != nil {
+		return err
+	}
+	for i := range questions {
+		questions[i].Snippet = snippets[questions[i].ID]
+	}
+	return nil
+}
+
+// loadEmojis fills Question.Emojis with the JSON encoded counters, in the same
+// shape the field had when reactions were stored on the question row.
+func loadEmojis(questions []database.Question) error {
+	if len(questions) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(questions))
+	for _, q := range questions {
+		ids = append(ids, q.ID)
+	}
+	var counts []database.EmojiCount
+	err := database.DB.Where("question_id in ?", ids).Order("count desc").Order("emoji").Find(&counts).Error
+	if err != nil {
+		return err
+	}
+	records := make(map[int][]*EmojiRecord)
+	for _, e := range counts {
+		records[e.QuestionID] = append(records[e.QuestionID], &EmojiRecord{Value: e.Emoji, Count: e.Count})
+	}
+	for i := range questions {
+		emojis, ok := records[int(questions[i].ID)]
+		if !ok {
+			questions[i].Emojis = ""
+			continue
+		}
+		b, err := json.Marshal(emojis)
+		if err != nil {
+			return err
+		}
+		questions[i].Emojis = string(b)
+	}
+	return nil
 }
 
 func (this *QuestionController) SSE(c *gin.Context) {
@@ -436,8 +1013,16 @@ func (this *QuestionController) SSE(c *gin.Context) {
 	// Create a channel for this client
 	clientChan := make(chan SSEvent, 1024)
 
-	// Add client to the connection manager
+	// Add client to the connection manager, unless the server is shutting down
 	this.clientsMutex.Lock()
+	if this.closing() {
+		this.clientsMutex.Unlock()
+		c.Stream(func(w io.Writer) bool {
+			encodeRetry(w)
+			return false
+		})
+		return
+	}
 	this.clients[clientChan] = true
 	this.clientsMutex.Unlock()
 
@@ -460,7 +1045,7 @@ func (this *QuestionController) SSE(c *gin.Context) {
 				Data:  "connected",
 			})
 			if err != nil {
-				log.Error("Failed to encode connected event:", err)
+				logger(c).Error("Failed to encode connected event:", err)
 				return false
 			}
 			messageID++
@@ -469,12 +1054,14 @@ func (this *QuestionController) SSE(c *gin.Context) {
 
 		select {
 		case <-clientGone:
-			log.Info("Client disconnected")
-			// Remove client from connection manager
+			logger(c).Info("Client disconnected")
+			// Remove client from connection manager, unless it was already removed
 			this.clientsMutex.Lock()
-			delete(this.clients, clientChan)
+			if this.clients[clientChan] {
+				delete(this.clients, clientChan)
+				close(clientChan)
+			}
 			this.clientsMutex.Unlock()
-			close(clientChan)
 			return false
 		case <-heartbeat.C:
 			// Send heartbeat comment
@@ -483,14 +1070,21 @@ func (this *QuestionController) SSE(c *gin.Context) {
 				Data:  "heartbeat",
 			})
 			if err != nil {
-				log.Error("Failed to encode heartbeat event:", err)
+				logger(c).Error("Failed to encode heartbeat event:", err)
 				return false
 			}
 			return true
-		case emojis := <-clientChan:
+		case emojis, ok := <-clientChan:
+			if !ok {
+				// Dropped or shutting down, ask the client to reconnect
+				if err := encodeRetry(w); err != nil {
+					logger(c).Error("Failed to encode retry event:", err)
+				}
+				return false
+			}
 			emojiJson, err := json.Marshal(emojis)
 			if err != nil {
-				log.Error("Failed to marshal emoji data:", err)
+				logger(c).Error("Failed to marshal emoji data:", err)
 				return false
 			}
 
@@ -501,7 +1095,7 @@ func (this *QuestionController) SSE(c *gin.Context) {
 				Data:  string(emojiJson),
 			})
 			if err != nil {
-				log.Error("Failed to encode emoji event:", err)
+				logger(c).Error("Failed to encode emoji event:", err)
 				return false
 			}
 			messageID++
@@ -513,7 +1107,7 @@ func (this *QuestionController) SSE(c *gin.Context) {
 				Retry: 10000,
 			})
 			if err != nil {
-				log.Error("Failed to encode retry event:", err)
+				logger(c).Error("Failed to encode retry event:", err)
 				return false
 			}
 			return true
@@ -521,26 +1115,38 @@ func (this *QuestionController) SSE(c *gin.Context) {
 	})
 
 	// Cleanup when connection is closed
-	log.Info("SSE connection closed")
+	logger(c).Info("SSE connection closed")
 }
 
 // WebSocket handler for real-time updates
 func (this *QuestionController) WebSocket(c *gin.Context) {
+	if checkBan(c) {
+		return
+	}
 	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Error("Failed to upgrade to WebSocket:", err)
+		logger(c).Error("Failed to upgrade to WebSocket:", err)
 		return
 	}
 
 	// Generate a unique client ID
 	clientID := fmt.Sprintf("%d", time.Now().UnixNano())
 
-	// Add client to the connection manager
+	// Add client to the connection manager, unless the server is shutting down
 	this.wsClientsMutex.Lock()
+	if this.closing() {
+		this.wsClientsMutex.Unlock()
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting"), time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
 	this.wsClients[conn] = true
 	this.wsClientsMutex.Unlock()
 
-	log.Info("WebSocket client connected:", clientID)
+	// The gin context is reused once the handler returns, so the goroutines
+	// below keep their own logger
+	wsLog := logger(c)
+	wsLog.Info("WebSocket client connected:", clientID)
 
 	// Send initial connection message with client ID
 	conn.WriteJSON(map[string]string{"type": "connected", "clientId": clientID})
@@ -555,7 +1161,7 @@ func (this *QuestionController) WebSocket(c *gin.Context) {
 			delete(this.wsClients, conn)
 			this.wsClientsMutex.Unlock()
 			conn.Close()
-			log.Info("WebSocket client disconnected:", clientID)
+			wsLog.Info("WebSocket client disconnected:", clientID)
 		}()
 
 		// Set up ping/pong for keepalive
@@ -569,7 +1175,7 @@ func (this *QuestionController) WebSocket(c *gin.Context) {
 			_, message, err := conn.ReadMessage()
 			if err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Error("WebSocket error:", err)
+					wsLog.Error("WebSocket error:", err)
 				}
 				break
 			}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"joiask-backend/internal/database"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SessionController struct{}
+
+type SessionRequest struct {
+	Title   string     `json:"title" binding:"required"`
+	StartAt time.Time  `json:"start_at" binding:"required"`
+	EndAt   *time.Time `json:"end_at"`
+	TagID   int        `json:"tag_id"`
+}
+
+// validate checks the request and copies it into session
+func (request SessionRequest) validate(c *gin.Context, session *database.Session) bool {
+	if request.EndAt != nil && !request.EndAt.After(request.StartAt) {
+		Fail(c, 400, "结束时间必须晚于开始时间")
+		return false
+	}
+	if request.TagID > 0 {
+		var tag database.Tag
+		if database.DB.Limit(1).Find(&tag, request.TagID).RowsAffected == 0 {
+			Fail(c, 404, "话题不存在")
+			return false
+		}
+	}
+	session.Title = request.Title
+	session.StartAt = database.StoredTime(request.StartAt)
+	session.EndAt = nil
+	if request.EndAt != nil {
+		end := database.StoredTime(*request.EndAt)
+		session.EndAt = &end
+	}
+	session.TagID = request.TagID
+	return true
+}
+
+// Get all sessions, newest first
+func (*SessionController) Get(c *gin.Context) {
+	var list []database.Session
+	if err := database.DB.Order("start_at desc").Find(&list).Error; err != nil {
+		logger(c).Errorf("failed to get sessions: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	Success(c, list)
+}
+
+// Post creates a session, questions already submitted during it are linked
+func (*SessionController) Post(c *gin.Context) {
+	var request SessionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		Fail(c, 400, "请求错误")
+		return
+	}
+	var session database.Session
+	if !request.validate(c, &session) {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		return database.LinkSessionQuestions(tx, session)
+	})
+	if err != nil {
+		logger(c).Errorf("failed to create session: %v", err)
+		Fail(c, 500, "创建场次失败")
+		return
+	}
+	Success(c, session)
+}
+
+// Put modifies a session, its questions are linked again for the new window
+func (*SessionController) Put(c *gin.Context) {
+	var session database.Session
+	database.DB.First(&session, c.Param("id"))
+	if session.ID == 0 {
+		Fail(c, 404, "场次不存在")
+		return
+	}
+	var request SessionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		Fail(c, 400, "请求错误")
+		return
+	}
+	if !request.validate(c, &session) {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&session).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&database.Question{}).Where("session_id = ?", session.ID).UpdateColumn("session_id", 0).Error
+		if err != nil {
+			return err
+		}
+		return database.LinkSessionQuestions(tx, session)
+	})
+	if err != nil {
+		logger(c).Errorf("failed to save session: %v", err)
+		Fail(c, 500, "修改场次失败")
+		return
+	}
+	Success(c, session)
+}
+
+// Delete removes a session, its questions are kept without a session
+func (*SessionController) Delete(c *gin.Context) {
+	var session database.Session
+	database.DB.First(&session, c.Param("id"))
+	if session.ID == 0 {
+		Fail(c, 404, "场次不存在")
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&database.Question{}).Where("session_id = ?", session.ID).UpdateColumn("session_id", 0).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&session).Error
+	})
+	if err != nil {
+		logger(c).Errorf("failed to delete session: %v", err)
+		Fail(c, 500, "删除场次失败")
+		return
+	}
+	Success(c, nil)
+}
@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"joiask-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ShadowController struct{}
+
+type ShadowBanRequest struct {
+	Reason string `json:"reason"`
+}
+
+// isShadowBanned reports whether submissions with the IP fingerprint or the
+// visitor hash should be hidden, so that changing either one is not enough.
+func isShadowBanned(c *gin.Context, fingerprint, visitor string) bool {
+	if fingerprint == "" && visitor == "" {
+		return false
+	}
+	var count int64
+	if err := database.DB.Model(&database.ShadowBan{}).
+		Where(submitterCondition("fingerprint", "visitor", fingerprint, visitor)).
+		Count(&count).Error; err != nil {
+		logger(c).Errorf("failed to check shadow ban: %v", err)
+		return false
+	}
+	return count > 0
+}
+
+// submitterCondition matches rows whose IP column or visitor column equals the
+// given hashes, empty hashes never match.
+func submitterCondition(ipColumn, visitorColumn, fingerprint, visitor string) *gorm.DB {
+	cond := database.DB.Where("1 = 0")
+	if fingerprint != "" {
+		cond = cond.Or(ipColumn+" = ?", fingerprint)
+	}
+	if visitor != "" {
+		cond = cond.Or(visitorColumn+" = ?", visitor)
+	}
+	return cond
+}
+
+// Get all shadow bans
+func (*ShadowController) Get(c *gin.Context) {
+	var list []database.ShadowBan
+	if err := database.DB.Order("id desc").Find(&list).Error; err != nil {
+		logger(c).Errorf("failed to get shadow bans: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	Success(c, list)
+}
+
+// Post shadow-ban the submitter of a question, the pending submissions of the
+// submitter are moved into the hidden bucket as well.
+func (*ShadowController) Post(c *gin.Context) {
+	var request ShadowBanRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		Fail(c, 400, "请求错误")
+		return
+	}
+	var q database.Question
+	database.DB.First(&q, c.Param("id"))
+	if q.ID == 0 {
+		Fail(c, 404, "提问不存在")
+		return
+	}
+	if q.SubmitterHash == "" {
+		Fail(c, 400, "该提问没有记录提问者")
+		return
+	}
+	if isShadowBanned(c, q.SubmitterHash, q.SubmitterVisitor) {
+		Fail(c, 400, "该提问者已被隐藏")
+		return
+	}
+	shadowBan := database.ShadowBan{
+		Fingerprint: q.SubmitterHash,
+		Visitor:     q.SubmitterVisitor,
+		QuestionID:  int(q.ID),
+		Reason:      request.Reason,
+		CreatedBy:   c.MustGet("user").(database.Admin).ID,
+	}
+	tx := database.DB.Begin()
+	if err := tx.Create(&shadowBan).Error; err != nil {
+		logger(c).Errorf("failed to create shadow ban: %v", err)
+		Fail(c, 500, "创建封禁失败")
+		tx.Rollback()
+		return
+	}
+	err := tx.Model(&database.Question{}).
+		Where(submitterCondition("submitter_hash", "submitter_visitor", q.SubmitterHash, q.SubmitterVisitor)).
+		Where("is_publish = ?", false).
+		Update("is_shadow", true).Error
+	if err != nil {
+		logger(c).Errorf("failed to hide questions: %v", err)
+		Fail(c, 500, "创建封禁失败")
+		tx.Rollback()
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		logger(c).Errorf("failed to create shadow ban: %v", err)
+		Fail(c, 500, "创建封禁失败")
+		return
+	}
+	Success(c, shadowBan)
+}
+
+func (*ShadowController) Delete(c *gin.Context) {
+	var shadowBan database.ShadowBan
+	database.DB.First(&shadowBan, c.Param("id"))
+	if shadowBan.ID == 0 {
+		Fail(c, 404, "封禁不存在")
+		return
+	}
+	if err := database.DB.Delete(&shadowBan).Error; err != nil {
+		logger(c).Errorf("failed to delete shadow ban: %v", err)
+		Fail(c, 500, "删除封禁失败")
+		return
+	}
+	Success(c, nil)
+}
+
+// Restore moves a question out of the hidden bucket into the review queue
+func (*ShadowController) Restore(c *gin.Context) {
+	var q database.Question
+	database.DB.First(&q, c.Param("id"))
+	if q.ID == 0 {
+		Fail(c, 404, "提问不存在")
+		return
+	}
+	if err := database.DB.Model(&q).Update("is_shadow", false).Error; err != nil {
+		logger(c).Errorf("failed to restore question: %v", err)
+		Fail(c, 500, "修改提问失败")
+		return
+	}
+	Success(c, nil)
+}
+
+// Purge deletes every question in the hidden bucket
+func (*ShadowController) Purge(c *gin.Context) {
+	var questions []database.Question
+	if err := database.DB.Where("is_shadow = ?", true).Find(&questions).Error; err != nil {
+		logger(c).Errorf("failed to get hidden questions: %v", err)
+		Fail(c, 500, "删除提问失败")
+		return
+	}
+	if len(questions) == 0 {
+		Success(c, gin.H{"deleted": 0})
+		return
+	}
+	ids := make([]uint, 0, len(questions))
+	for _, q := range questions {
+		ids = append(ids, q.ID)
+	}
+	tx := database.DB.Begin()
+	if err := tx.Where("question_id in ?", ids).Delete(&database.LikeRecord{}).Error; err != nil {
+		logger(c).Errorf("failed to delete like records: %v", err)
+		Fail(c, 500, "删除提问失败")
+		tx.Rollback()
+		return
+	}
+	if err := tx.Where("question_id in ?", ids).Delete(&database.Reaction{}).Error; err != nil {
+		logger(c).Errorf("failed to delete reactions: %v", err)
+		Fail(c, 500, "删除提问失败")
+		tx.Rollback()
+		return
+	}
+	if err := tx.Where("question_id in ?", ids).Delete(&database.EmojiCount{}).Error; err != nil {
+		logger(c).Errorf("failed to delete emoji counts: %v", err)
+		Fail(c, 500, "删除提问失败")
+		tx.Rollback()
+		return
+	}
+	if err := tx.Delete(&database.Question{}, ids).Error; err != nil {
+		logger(c).Errorf("failed to delete hidden questions: %v", err)
+		Fail(c, 500, "删除提问失败")
+		tx.Rollback()
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		logger(c).Errorf("failed to delete hidden questions: %v", err)
+		Fail(c, 500, "删除提问失败")
+		return
+	}
+	for _, q := range questions {
+		deleteImages(c, q.Images)
+	}
+	Success(c, gin.H{"deleted": len(ids)})
+}
@@ -2,27 +2,41 @@ package controller
 
 import (
 	"joiask-backend/internal/database"
+	"sort"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
 )
 
 type StatisticsController struct{}
 
 type StatisticsResponse struct {
-	TotalQuestions     int64     `json:"total_questions"`
-	TotalTags          int64     `json:"total_tags"`
-	TotalUsers         int64     `json:"total_users"`
-	TotalImages        int64     `json:"total_images"`
-	RainbowQuestions   int64     `json:"rainbow_questions"`
-	ArchivedQuestions  int64     `json:"archived_questions"`
-	PublishedQuestions int64     `json:"published_questions"`
-	TagStats           []TagStat `json:"tag_stats"`
+	TotalQuestions     int64         `json:"total_questions"`
+	TotalTags          int64         `json:"total_tags"`
+	TotalUsers         int64         `json:"total_users"`
+	TotalImages        int64         `json:"total_images"`
+	RainbowQuestions   int64         `json:"rainbow_questions"`
+	ArchivedQuestions  int64         `json:"archived_questions"`
+	PublishedQuestions int64         `json:"published_questions"`
+	TagStats           []TagStat     `json:"tag_stats"`
+	SessionStats       []SessionStat `json:"session_stats"`
+}
+
+type SessionStat struct {
+	Session            database.Session `json:"session"`
+	TotalQuestions     int64            `json:"total_questions"`
+	PublishedQuestions int64            `json:"published_questions"`
+	ArchivedQuestions  int64            `json:"archived_questions"`
+	TotalImages        int64            `json:"total_images"`
+	TotalReactions     int64            `json:"total_reactions"`
 }
 
 type TagStat struct {
-	Tag   database.Tag `json:"tag"`
-	Count int64        `json:"count"`
+	Tag    database.Tag       `json:"tag"`
+	Count  int64              `json:"count"`
+	Counts database.TagCounts `json:"counts"`
 }
 
 func (*StatisticsController) Get(c *gin.Context) {
@@ -30,21 +44,21 @@ func (*StatisticsController) Get(c *gin.Context) {
 
 	// Count total questions
 	if err := database.DB.Model(&database.Question{}).Count(&stats.TotalQuestions).Error; err != nil {
-		log.Errorf("failed to count questions: %v", err)
+		logger(c).Errorf("failed to count questions: %v", err)
 		Fail(c, 500, "内部错误")
 		return
 	}
 
 	// Count total tags
 	if err := database.DB.Model(&database.Tag{}).Count(&stats.TotalTags).Error; err != nil {
-		log.Errorf("failed to count tags: %v", err)
+		logger(c).Errorf("failed to count tags: %v", err)
 		Fail(c, 500, "内部错误")
 		return
 	}
 
 	// Count total users
 	if err := database.DB.Model(&database.Admin{}).Count(&stats.TotalUsers).Error; err != nil {
-		log.Errorf("failed to count users: %v", err)
+		logger(c).Errorf("failed to count users: %v", err)
 		Fail(c, 500, "内部错误")
 		return
 	}
@@ -54,7 +68,7 @@ func (*StatisticsController) Get(c *gin.Context) {
 		Total int64
 	}
 	if err := database.DB.Model(&database.Question{}).Select("COALESCE(SUM(images_num), 0) as total").Scan(&totalImages).Error; err != nil {
-		log.Errorf("failed to sum images: %v", err)
+		logger(c).Errorf("failed to sum images: %v", err)
 		Fail(c, 500, "内部错误")
 		return
 	}
@@ -62,21 +76,21 @@ func (*StatisticsController) Get(c *gin.Context) {
 
 	// Count rainbow questions
 	if err := database.DB.Model(&database.Question{}).Where("is_rainbow = ?", true).Count(&stats.RainbowQuestions).Error; err != nil {
-		log.Errorf("failed to count rainbow questions: %v", err)
+		logger(c).Errorf("failed to count rainbow questions: %v", err)
 		Fail(c, 500, "内部错误")
 		return
 	}
 
 	// Count archived questions
 	if err := database.DB.Model(&database.Question{}).Where("is_archive = ?", true).Count(&stats.ArchivedQuestions).Error; err != nil {
-		log.Errorf("failed to count archived questions: %v", err)
+		logger(c).Errorf("failed to count archived questions: %v", err)
 		Fail(c, 500, "内部错误")
 		return
 	}
 
 	// Count published questions
 	if err := database.DB.Model(&database.Question{}).Where("is_publish = ?", true).Count(&stats.PublishedQuestions).Error; err != nil {
-		log.Errorf("failed to count published questions: %v", err)
+		logger(c).Errorf("failed to count published questions: %v", err)
 		Fail(c, 500, "内部错误")
 		return
 	}
@@ -84,23 +98,368 @@ func (*StatisticsController) Get(c *gin.Context) {
 	// Get tag statistics
 	var tags []database.Tag
 	if err := database.DB.Find(&tags).Error; err != nil {
-		log.Errorf("failed to get tags: %v", err)
+		logger(c).Errorf("failed to get tags: %v", err)
 		Fail(c, 500, "内部错误")
 		return
 	}
 
+	counts, err := database.CountTags()
+	if err != nil {
+		logger(c).Errorf("failed to count tags: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
 	stats.TagStats = make([]TagStat, 0, len(tags))
 	for _, tag := range tags {
-		var count int64
-		if err := database.DB.Model(&database.Question{}).Where("tag_id = ?", tag.ID).Count(&count).Error; err != nil {
-			log.Errorf("failed to count questions for tag %d: %v", tag.ID, err)
-			continue
-		}
 		stats.TagStats = append(stats.TagStats, TagStat{
-			Tag:   tag,
-			Count: count,
+			Tag:    tag,
+			Count:  counts[int(tag.ID)].Total,
+			Counts: counts[int(tag.ID)],
 		})
 	}
 
+	// Get session statistics
+	var sessions []database.Session
+	if err := database.DB.Order("start_at desc").Find(&sessions).Error; err != nil {
+		logger(c).Errorf("failed to get sessions: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	var sessionCounts []struct {
+		SessionID int
+		Total     int64
+		Published int64
+		Archived  int64
+		Images    int64
+		Reactions int64
+	}
+	err = database.DB.Model(&database.Question{}).
+		Select("session_id, count(*) as total, " +
+			"COALESCE(SUM(CASE WHEN is_publish THEN 1 ELSE 0 END), 0) as published, " +
+			"COALESCE(SUM(CASE WHEN is_archive THEN 1 ELSE 0 END), 0) as archived, " +
+			"COALESCE(SUM(images_num), 0) as images, " +
+			"COALESCE(SUM(likes), 0) as reactions").
+		Where("session_id > 0").Group("session_id").Scan(&sessionCounts).Error
+	if err != nil {
+		logger(c).Errorf("failed to count questions for sessions: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	stats.SessionStats = make([]SessionStat, 0, len(sessions))
+	for _, session := range sessions {
+		stat := SessionStat{Session: session}
+		for _, count := range sessionCounts {
+			if count.SessionID == int(session.ID) {
+				stat.TotalQuestions = count.Total
+				stat.PublishedQuestions = count.Published
+				stat.ArchivedQuestions = count.Archived
+				stat.TotalImages = count.Images
+				stat.TotalReactions = count.Reactions
+			}
+		}
+		stats.SessionStats = append(stats.SessionStats, stat)
+	}
+
 	Success(c, stats)
 }
+
+type SeriesRequest struct {
+	// Bucket is hour, day or week
+	Bucket string `form:"bucket"`
+	From   string `form:"from"`
+	To     string `form:"to"`
+	TagID  int    `form:"tag_id"`
+}
+
+type SeriesBucket struct {
+	Start        time.Time      `json:"start"`
+	Submissions  int            `json:"submissions"`
+	Publications int            `json:"publications"`
+	Archives     int            `json:"archives"`
+	Reactions    map[string]int `json:"reactions"`
+	// MedianPublishSeconds is the median time from submission to publish of
+	// the questions published in the bucket, nil if there are none
+	MedianPublishSeconds *float64 `json:"median_publish_seconds"`
+	publishDelays        []float64
+}
+
+type SeriesResponse struct {
+	Bucket   string    `json:"bucket"`
+	Timezone string    `json:"timezone"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	// MedianSampled is set if the medians only cover the latest publications
+	MedianSampled bool            `json:"median_sampled"`
+	Buckets       []*SeriesBucket `json:"buckets"`
+}
+
+// maxSeriesBuckets limits the size of a series
+const maxSeriesBuckets = 2000
+
+// maxMedianQuestions limits the publications loaded for the median delays
+const maxMedianQuestions = 10000
+
+// seriesBuckets returns the default range and the start of the bucket holding
+// a time for each bucket size, weeks start on Monday. Width and shift align
+// the buckets on the local seconds since the epoch in SQL, the epoch was on a
+// Thursday so weeks are shifted by three days.
+var seriesBuckets = map[string]struct {
+	span  time.Duration
+	width int64
+	shift int64
+	start func(t time.Time) time.Time
+	next  func(t time.Time) time.Time
+}{
+	"hour": {
+		span:  2 * 24 * time.Hour,
+		width: 3600,
+		start: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+		},
+		next: func(t time.Time) time.Time { return t.Add(time.Hour) },
+	},
+	"day": {
+		span:  30 * 24 * time.Hour,
+		width: 24 * 3600,
+		start: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		},
+		next: func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+	},
+	"week": {
+		span:  26 * 7 * 24 * time.Hour,
+		width: 7 * 24 * 3600,
+		shift: 3 * 24 * 3600,
+		start: func(t time.Time) time.Time {
+			offset := (int(t.Weekday()) + 6) % 7
+			return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+		},
+		next: func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+	},
+}
+
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// Series returns the statistics bucketed by hour, day or week in the
+// configured time zone
+func (*StatisticsController) Series(c *gin.Context) {
+	var request SeriesRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		Fail(c, 400, "请求错误")
+		return
+	}
+	if request.Bucket == "" {
+		request.Bucket = "day"
+	}
+	bucket, ok := seriesBuckets[request.Bucket]
+	if !ok {
+		Fail(c, 400, "无效的统计周期")
+		return
+	}
+	loc := database.Location()
+	to := time.Now()
+	if request.To != "" {
+		t, err := parseTime(request.To, true)
+		if err != nil {
+			Fail(c, 400, "无效的时间")
+			return
+		}
+		to = t
+	}
+	from := to.Add(-bucket.span)
+	if request.From != "" {
+		t, err := parseTime(request.From, false)
+		if err != nil {
+			Fail(c, 400, "无效的时间")
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		Fail(c, 400, "结束时间必须晚于开始时间")
+		return
+	}
+
+	response := SeriesResponse{Bucket: request.Bucket, Timezone: loc.String(), From: from.In(loc), To: to.In(loc)}
+	var checkpoints []time.Time
+	for t := bucket.start(from.In(loc)); t.Before(to); t = bucket.next(t) {
+		if len(response.Buckets) >= maxSeriesBuckets {
+			Fail(c, 400, "统计范围过大")
+			return
+		}
+		response.Buckets = append(response.Buckets, &SeriesBucket{Start: t, Reactions: map[string]int{}})
+		checkpoints = append(checkpoints, t)
+	}
+	scale := newSeriesScale(bucket.width, bucket.shift, append(checkpoints, to.In(loc)))
+	index := make(map[int64]*SeriesBucket)
+	for _, b := range response.Buckets {
+		index[b.Start.Unix()] = b
+	}
+	find := func(t time.Time) *SeriesBucket {
+		return index[bucket.start(t.In(loc)).Unix()]
+	}
+	questions := func(column string) *gorm.DB {
+		tx := database.DB.Model(&database.Question{}).
+			Where("is_shadow = ?", false).
+			Where(column+" >= ? and "+column+" < ?", from, to)
+		if request.TagID > 0 {
+			tx = tx.Where("tag_id = ?", request.TagID)
+		}
+		return tx
+	}
+	count := func(column string, add func(b *SeriesBucket, n int)) error {
+		epoch, start, args := scale.sql(column)
+		var rows []struct {
+			At    int64
+			Count int
+		}
+		err := questions(column).Select(start+" as bucket, min("+epoch+") as at, count(*) as count", args...).
+			Group("bucket").Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			if b := find(time.Unix(r.At, 0)); b != nil {
+				add(b, r.Count)
+			}
+		}
+		return nil
+	}
+
+	if err := count("created_at", func(b *SeriesBucket, n int) { b.Submissions += n }); err != nil {
+		logger(c).Errorf("failed to count submissions: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	if err := count("published_at", func(b *SeriesBucket, n int) { b.Publications += n }); err != nil {
+		logger(c).Errorf("failed to count publications: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	if err := count("archived_at", func(b *SeriesBucket, n int) { b.Archives += n }); err != nil {
+		logger(c).Errorf("failed to count archives: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+
+	epoch, start, args := scale.sql("reactions.created_at")
+	var reactions []struct {
+		At    int64
+		Emoji string
+		Count int
+	}
+	tx := database.DB.Model(&database.Reaction{}).
+		Select(start+" as bucket, reactions.emoji, min("+epoch+") as at, count(*) as count", args...).
+		Where("reactions.created_at >= ? and reactions.created_at < ?", from, to)
+	if request.TagID > 0 {
+		tx = tx.Joins("JOIN questions ON questions.id = reactions.question_id").Where("questions.tag_id = ?", request.TagID)
+	}
+	if err := tx.Group("bucket, reactions.emoji").Scan(&reactions).Error; err != nil {
+		logger(c).Errorf("failed to count reactions: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	for _, r := range reactions {
+		if b := find(time.Unix(r.At, 0)); b != nil {
+			b.Reactions[r.Emoji] += r.Count
+		}
+	}
+
+	// The median needs every delay, only the latest publications are loaded
+	var published []database.Question
+	err := questions("published_at").Select("created_at, published_at").
+		Order("published_at desc").Limit(maxMedianQuestions).Find(&published).Error
+	if err != nil {
+		logger(c).Errorf("failed to load publications: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	response.MedianSampled = len(published) == maxMedianQuestions
+	for _, q := range published {
+		if b := find(*q.PublishedAt); b != nil {
+			b.publishDelays = append(b.publishDelays, q.PublishedAt.Sub(q.CreatedAt).Seconds())
+		}
+	}
+	for _, b := range response.Buckets {
+		if len(b.publishDelays) > 0 {
+			m := median(b.publishDelays)
+			b.MedianPublishSeconds = &m
+		}
+	}
+	Success(c, response)
+}
+
+// seriesScale groups the rows of a series by bucket in SQL. The start of the
+// bucket holding a row is computed with the time zone offset at the row, which
+// is not constant, so the expression switches the offset at every change
+// within the series. Rows with different offsets in the same bucket fall into
+// different groups, each group is assigned to its bucket by one of its rows.
+type seriesScale struct {
+	width   int64
+	shift   int64
+	offset  int64
+	changes []zoneChange
+}
+
+// zoneChange is a change of the time zone offset at unix time at
+type zoneChange struct {
+	at     int64
+	offset int64
+}
+
+// newSeriesScale finds the offset changes between the checkpoints, which are
+// in the time zone of the series and close enough to hold one change at most.
+func newSeriesScale(width, shift int64, checkpoints []time.Time) *seriesScale {
+	_, offset := checkpoints[0].Zone()
+	scale := &seriesScale{width: width, shift: shift, offset: int64(offset)}
+	last := offset
+	for i := 1; i < len(checkpoints); i++ {
+		_, next := checkpoints[i].Zone()
+		if next == last {
+			continue
+		}
+		// The first second with the new offset
+		loc := checkpoints[i].Location()
+		lo, hi := checkpoints[i-1].Unix(), checkpoints[i].Unix()
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			if _, o := time.Unix(mid, 0).In(loc).Zone(); o == last {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		scale.changes = append(scale.changes, zoneChange{at: hi, offset: int64(next)})
+		last = next
+	}
+	return scale
+}
+
+// sql returns the expression of the unix time of a time column, and the
+// expression of the unix time the bucket of the row starts at. Times are
+// stored as UTC by MySQL and with their offset by SQLite.
+func (s *seriesScale) sql(column string) (string, string, []any) {
+	epoch := "CAST(strftime('%s', " + column + ") AS INTEGER)"
+	if viper.GetString("db_type") == "mysql" {
+		epoch = "TIMESTAMPDIFF(SECOND, '1970-01-01', " + column + ")"
+	}
+	offset := "?"
+	var args []any
+	if len(s.changes) > 0 {
+		offset = "CASE"
+		for i := len(s.changes) - 1; i >= 0; i-- {
+			offset += " WHEN " + epoch + " >= ? THEN ?"
+			args = append(args, s.changes[i].at, s.changes[i].offset)
+		}
+		offset += " ELSE ? END"
+	}
+	args = append(args, s.offset, s.shift, s.width)
+	return epoch, epoch + " - ((" + epoch + " + " + offset + " + ?) % ?)", args
+}
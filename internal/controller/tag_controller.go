@@ -1,25 +1,129 @@
 package controller
 
 import (
+	"encoding/json"
 	"joiask-backend/internal/database"
 
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
-	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
-type TagController struct{}
+type TagController struct {
+	events *QuestionController
+}
+
+func NewTagController(events *QuestionController) *TagController {
+	return &TagController{events: events}
+}
+
+type TagMergeRequest struct {
+	TargetID     int  `json:"target_id" binding:"required"`
+	DeleteSource bool `json:"delete_source"`
+}
+
+type TagMergeData struct {
+	SourceID uint  `json:"source_id"`
+	TargetID uint  `json:"target_id"`
+	Moved    int64 `json:"moved"`
+	Deleted  bool  `json:"deleted"`
+}
 
 type TagRequest struct {
 	TagName     string `json:"tag_name"`
 	Description string `json:"description"`
+	// ParentID, SortOrder, Window and Settings are kept if not given
+	ParentID  *int                       `json:"parent_id"`
+	SortOrder *int                       `json:"sort_order"`
+	Window    *database.SubmissionWindow `json:"window"`
+	Settings  *database.TagSettings      `json:"settings"`
 }
 
-// Get all tags
+// Get the tag tree, hidden tags and their children are only listed for admins
 func (t *TagController) Get(c *gin.Context) {
 	var tags []database.Tag
-	database.DB.Find(&tags)
-	Success(c, lo.Map(tags, func(t database.Tag, _ int) interface{} { return t.Json() }))
+	database.DB.Order("sort_order asc").Order("id asc").Find(&tags)
+	counts, err := database.CountTags()
+	if err != nil {
+		logger(c).Errorf("failed to count tags: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	Success(c, tagTree(tags, counts, database.BoxWindow(), sessions.Default(c).Get("authed") == true))
+}
+
+// tagTree nests tags under their parents in order, tags with a missing parent
+// are placed at the top level
+func tagTree(tags []database.Tag, counts map[int]database.TagCounts, box database.SubmissionWindow, admin bool) []map[string]interface{} {
+	ids := lo.SliceToMap(tags, func(t database.Tag) (int, bool) { return int(t.ID), true })
+	children := lo.GroupBy(tags, func(t database.Tag) int {
+		if ids[t.ParentID] {
+			return t.ParentID
+		}
+		return 0
+	})
+	var build func(parent int) []map[string]interface{}
+	build = func(parent int) []map[string]interface{} {
+		nodes := []map[string]interface{}{}
+		for _, tag := range children[parent] {
+			if tag.Settings.IsHidden && !admin {
+				continue
+			}
+			node := tag.Json(counts[int(tag.ID)], box, admin)
+			node["children"] = build(int(tag.ID))
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+	return build(0)
+}
+
+// validParent reports whether parent can be the parent of tag without a cycle,
+// a parent whose own ancestors already form a cycle is refused as well
+func validParent(tag database.Tag, parent int) bool {
+	visited := make(map[int]bool)
+	for id := parent; id != 0; {
+		if (tag.ID != 0 && id == int(tag.ID)) || visited[id] {
+			return false
+		}
+		visited[id] = true
+		var p database.Tag
+		if database.DB.Limit(1).Find(&p, id).RowsAffected == 0 {
+			return false
+		}
+		id = p.ParentID
+	}
+	return true
+}
+
+// applyTagRequest copies the optional fields of the request into tag
+func applyTagRequest(c *gin.Context, tag *database.Tag, tagRequest TagRequest) bool {
+	if tagRequest.ParentID != nil {
+		if !validParent(*tag, *tagRequest.ParentID) {
+			Fail(c, 400, "无效的上级话题")
+			return false
+		}
+		tag.ParentID = *tagRequest.ParentID
+	}
+	if tagRequest.SortOrder != nil {
+		tag.SortOrder = *tagRequest.SortOrder
+	}
+	if tagRequest.Window != nil {
+		if err := tagRequest.Window.Validate(); err != nil {
+			Fail(c, 400, "无效的开放时间")
+			return false
+		}
+		tag.Window = *tagRequest.Window
+	}
+	if tagRequest.Settings != nil {
+		if err := tagRequest.Settings.Validate(); err != nil {
+			Fail(c, 400, "无效的话题设置")
+			return false
+		}
+		tag.Settings = *tagRequest.Settings
+	}
+	return true
 }
 
 // Put modify tag
@@ -35,10 +139,13 @@ func (t *TagController) Put(c *gin.Context) {
 		Fail(c, 400, "invalid request")
 		return
 	}
+	if !applyTagRequest(c, &tag, tagRequest) {
+		return
+	}
 	tag.TagName = tagRequest.TagName
 	tag.Description = tagRequest.Description
 	if err := database.DB.Save(&tag).Error; err != nil {
-		log.Errorf("failed to save tag: %v", err)
+		logger(c).Errorf("failed to save tag: %v", err)
 		Fail(c, 500, "internal server error")
 		return
 	}
@@ -53,10 +160,13 @@ func (t *TagController) Post(c *gin.Context) {
 		return
 	}
 	var tag database.Tag
+	if !applyTagRequest(c, &tag, tagRequest) {
+		return
+	}
 	tag.TagName = tagRequest.TagName
 	tag.Description = tagRequest.Description
 	if err := database.DB.Create(&tag).Error; err != nil {
-		log.Error("failed to create tag: ", err)
+		logger(c).Error("failed to create tag: ", err)
 		Fail(c, 401, "创建话题失败")
 		return
 	}
@@ -74,6 +184,12 @@ func (t *TagController) Delete(c *gin.Context) {
 		Fail(c, 403, "不能删除默认话题")
 		return
 	}
+	var childCount int64
+	database.DB.Model(&database.Tag{}).Where("parent_id = ?", tag.ID).Count(&childCount)
+	if childCount > 0 {
+		Fail(c, 400, "话题仍有子话题")
+		return
+	}
 	var questionCount int64
 	database.DB.Model(&database.Question{}).Where("tag_id = ?", tag.ID).Count(&questionCount)
 	if questionCount > 0 {
@@ -81,9 +197,155 @@ func (t *TagController) Delete(c *gin.Context) {
 		return
 	}
 	if err := database.DB.Delete(&tag).Error; err != nil {
-		log.Error("failed to delete tag: ", err.Error())
+		logger(c).Error("failed to delete tag: ", err.Error())
 		Fail(c, 500, "internal server error")
 		return
 	}
 	Success(c, nil)
 }
+
+// PostCover uploads the cover image of a tag
+func (t *TagController) PostCover(c *gin.Context) {
+	var tag database.Tag
+	database.DB.First(&tag, c.Param("id"))
+	if tag.ID == 0 {
+		Fail(c, 404, "话题不存在")
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		Fail(c, 400, "请求错误")
+		return
+	}
+	url, err := uploadImage(file)
+	if err != nil {
+		logger(c).Error(err)
+		Fail(c, 500, "文件上传失败")
+		return
+	}
+	if err := database.DB.Model(&tag).Update("cover_image", url).Error; err != nil {
+		logger(c).Errorf("failed to save tag: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	Success(c, tag)
+}
+
+// DeleteCover removes the cover image of a tag, the file is kept since
+// uploads are shared by content
+func (t *TagController) DeleteCover(c *gin.Context) {
+	var tag database.Tag
+	database.DB.First(&tag, c.Param("id"))
+	if tag.ID == 0 {
+		Fail(c, 404, "话题不存在")
+		return
+	}
+	if err := database.DB.Model(&tag).Update("cover_image", "").Error; err != nil {
+		logger(c).Errorf("failed to save tag: %v", err)
+		Fail(c, 500, "内部错误")
+		return
+	}
+	Success(c, tag)
+}
+
+// Merge moves all questions of a tag to another tag, the source tag can be
+// deleted in the same transaction
+func (t *TagController) Merge(c *gin.Context) {
+	var request TagMergeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		Fail(c, 400, "请求错误")
+		return
+	}
+	var source, target database.Tag
+	database.DB.First(&source, c.Param("id"))
+	database.DB.First(&target, request.TargetID)
+	if source.ID == 0 || target.ID == 0 {
+		Fail(c, 404, "话题不存在")
+		return
+	}
+	if source.ID == target.ID {
+		Fail(c, 400, "不能合并到同一个话题")
+		return
+	}
+	if request.DeleteSource && source.ID == 1 {
+		Fail(c, 403, "不能删除默认话题")
+		return
+	}
+	data := TagMergeData{SourceID: source.ID, TargetID: target.ID, Deleted: request.DeleteSource}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.Question{}).Where("tag_id = ?", source.ID).UpdateColumn("tag_id", target.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		data.Moved = result.RowsAffected
+		if request.DeleteSource {
+			if err := deleteMergedTag(tx, source, target); err != nil {
+				return err
+			}
+		}
+		detail, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&database.AuditLog{
+			Action:    "tag_merge",
+			Detail:    string(detail),
+			CreatedBy: c.MustGet("user").(database.Admin).ID,
+		}).Error
+	})
+	if err != nil {
+		logger(c).Errorf("failed to merge tags: %v", err)
+		Fail(c, 500, "合并话题失败")
+		return
+	}
+	t.events.Publish(SSEvent{
+		Type: SSEventTagMerge,
+		Data: data,
+	})
+	Success(c, data)
+}
+
+// deleteMergedTag deletes the source of a merge, its sessions and child tags
+// move to the target
+func deleteMergedTag(tx *gorm.DB, source database.Tag, target database.Tag) error {
+	if err := tx.Model(&database.Session{}).Where("tag_id = ?", source.ID).UpdateColumn("tag_id", target.ID).Error; err != nil {
+		return err
+	}
+	// A target below the source takes its place, otherwise the children of the
+	// source moving to the target would include an ancestor of the target
+	below, err := isDescendant(tx, target, int(source.ID))
+	if err != nil {
+		return err
+	}
+	if below {
+		if err := tx.Model(&target).UpdateColumn("parent_id", source.ParentID).Error; err != nil {
+			return err
+		}
+	}
+	err = tx.Model(&database.Tag{}).Where("parent_id = ? and id <> ?", source.ID, target.ID).UpdateColumn("parent_id", target.ID).Error
+	if err != nil {
+		return err
+	}
+	return tx.Delete(&source).Error
+}
+
+// isDescendant reports whether tag is below ancestor in the tree
+func isDescendant(tx *gorm.DB, tag database.Tag, ancestor int) (bool, error) {
+	visited := make(map[int]bool)
+	for id := tag.ParentID; id != 0 && !visited[id]; {
+		if id == ancestor {
+			return true, nil
+		}
+		visited[id] = true
+		var p database.Tag
+		result := tx.Limit(1).Find(&p, id)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return false, nil
+		}
+		id = p.ParentID
+	}
+	return false, nil
+}
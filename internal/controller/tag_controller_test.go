@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"fmt"
+	"joiask-backend/internal/database"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// openTagTree replaces the database with a fresh one holding tags by id, each
+// mapped to its parent id.
+func openTagTree(t *testing.T, parents map[int]int) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&database.Tag{}); err != nil {
+		t.Fatal(err)
+	}
+	for id, parent := range parents {
+		tag := database.Tag{TagName: fmt.Sprint("tag", id), ParentID: parent}
+		tag.ID = uint(id)
+		if err := db.Create(&tag).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+}
+
+// testTagTree is 1 > 2 > 3 and 4 at the top level, 5 and 6 are each other's
+// parent as left by an earlier bug.
+var testTagTree = map[int]int{1: 0, 2: 1, 3: 2, 4: 0, 5: 6, 6: 5}
+
+func tagWithParent(id int, parent int) database.Tag {
+	tag := database.Tag{ParentID: parent}
+	tag.ID = uint(id)
+	return tag
+}
+
+func TestValidParent(t *testing.T) {
+	openTagTree(t, testTagTree)
+	tests := []struct {
+		name   string
+		tag    database.Tag
+		parent int
+		want   bool
+	}{
+		{"new top level tag", tagWithParent(0, 0), 0, true},
+		{"new tag under a leaf", tagWithParent(0, 0), 3, true},
+		{"missing parent", tagWithParent(0, 0), 99, false},
+		{"move to the top level", tagWithParent(3, 2), 0, true},
+		{"move to another tree", tagWithParent(3, 2), 4, true},
+		{"own parent", tagWithParent(1, 0), 1, false},
+		{"under a child", tagWithParent(1, 0), 2, false},
+		{"under a grandchild", tagWithParent(1, 0), 3, false},
+		{"under a cycle", tagWithParent(0, 0), 5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validParent(tt.tag, tt.parent); got != tt.want {
+				t.Errorf("validParent(%d, %d) = %v, want %v", tt.tag.ID, tt.parent, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDescendant(t *testing.T) {
+	openTagTree(t, testTagTree)
+	tests := []struct {
+		name     string
+		tag      database.Tag
+		ancestor int
+		want     bool
+	}{
+		{"child", tagWithParent(2, 1), 1, true},
+		{"grandchild", tagWithParent(3, 2), 1, true},
+		{"parent", tagWithParent(3, 2), 2, true},
+		{"ancestor of the tag", tagWithParent(1, 0), 3, false},
+		{"itself", tagWithParent(1, 0), 1, false},
+		{"other tree", tagWithParent(4, 0), 1, false},
+		{"missing parent", tagWithParent(7, 99), 1, false},
+		{"cycle", tagWithParent(5, 6), 1, false},
+		{"inside a cycle", tagWithParent(5, 6), 6, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := isDescendant(database.DB, tt.tag, tt.ancestor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("isDescendant(%d, %d) = %v, want %v", tt.tag.ID, tt.ancestor, got, tt.want)
+			}
+		})
+	}
+}
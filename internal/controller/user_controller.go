@@ -5,7 +5,6 @@ import (
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
 )
 
 type UserController struct{}
@@ -96,7 +95,7 @@ func (*UserController) Put(c *gin.Context) {
 	}
 	user.Password = request.Password
 	if err := database.DB.Save(&user).Error; err != nil {
-		log.Errorf("failed to save user: %v", err)
+		logger(c).Errorf("failed to save user: %v", err)
 		Fail(c, 500, "内部错误")
 		return
 	}
@@ -118,7 +117,7 @@ func (*UserController) Post(c *gin.Context) {
 	user.Username = request.Username
 	user.Password = request.Password
 	if err := database.DB.Create(&user).Error; err != nil {
-		log.Errorf("failed to create user: %v", err)
+		logger(c).Errorf("failed to create user: %v", err)
 		Fail(c, 501, "创建用户失败")
 		return
 	}
@@ -142,7 +141,7 @@ func (*UserController) Delete(c *gin.Context) {
 		return
 	}
 	if err := database.DB.Delete(&user).Error; err != nil {
-		log.Errorf("failed to delete user: %v", err)
+		logger(c).Errorf("failed to delete user: %v", err)
 		Fail(c, 502, "删除用户失败")
 		return
 	}
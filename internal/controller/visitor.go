@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const visitorCookie = "jask_vid"
+
+// visitorID returns the anonymous visitor id of the client, a new id is
+// generated and set as cookie if the client does not have a valid one.
+func visitorID(c *gin.Context) string {
+	if id, err := c.Cookie(visitorCookie); err == nil && len(id) == 32 {
+		if _, err := hex.DecodeString(id); err == nil {
+			return id
+		}
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	id := hex.EncodeToString(b)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(visitorCookie, id, 365*24*3600, "/", "", false, true)
+	return id
+}
+
+// visitorHash identifies a visitor by client IP plus anonymous visitor id.
+func visitorHash(c *gin.Context) string {
+	return hashIP(c.ClientIP() + "|" + visitorID(c))
+}
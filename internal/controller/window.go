@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"joiask-backend/internal/database"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// closedMessage tells when a closed window opens again
+func closedMessage(message string, state database.SubmissionState) string {
+	if state.NextChange != nil {
+		return message + "，将于 " + state.NextChange.In(database.Location()).Format("01月02日 15:04") + " 开放"
+	}
+	return message
+}
+
+// checkWindow aborts the request if the box or the tag is closed
+func checkWindow(c *gin.Context, tag database.Tag) bool {
+	now := time.Now()
+	box := database.BoxWindow()
+	if state := database.SubmissionStateOf(now, box); !state.Open {
+		Fail(c, 403, closedMessage("提问箱暂未开放", state))
+		return true
+	}
+	if state := database.SubmissionStateOf(now, box, tag.Window); !state.Open {
+		Fail(c, 403, closedMessage("该话题暂未开放提问", state))
+		return true
+	}
+	return false
+}
@@ -1,16 +1,20 @@
 package database
 
 import (
+	"encoding/json"
 	"fmt"
+	"joiask-backend/internal/logging"
 	"joiask-backend/pkg/util"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var log = logging.Logger("database")
+
 var DB *gorm.DB
 
 const DefaultTagName = "提问箱"
@@ -33,12 +37,33 @@ func Init() {
 	initializeDB()
 }
 
+// Close closes the connection pool, waiting for running queries to finish.
+func Close() error {
+	db, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
 // initializeDB initializes the database, create tables and default records.
 func initializeDB() {
-	err := DB.AutoMigrate(&Question{}, &LikeRecord{}, &Admin{}, &Config{}, &Tag{})
+	err := DB.AutoMigrate(&Question{}, &LikeRecord{}, &Reaction{}, &EmojiCount{}, &Emoji{}, &Admin{}, &Config{}, &Tag{}, &Ban{}, &ShadowBan{}, &Session{}, &AuditLog{})
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := registerTagCountCallbacks(); err != nil {
+		log.Fatal("Failed to register callbacks.", err)
+	}
+	if err := registerMetricsCallbacks(); err != nil {
+		log.Fatal("Failed to register callbacks.", err)
+	}
+	if err := migrateEmojis(); err != nil {
+		log.Fatal("Failed to migrate emojis.", err)
+	}
+	if err := backfillHot(); err != nil {
+		log.Fatal("Failed to backfill hot scores.", err)
+	}
 	// Initialize default admin account.
 	if DB.Where("username = ?", "admin").First(&Admin{}).RowsAffected == 0 {
 		log.Info("Initializing default admin account.")
@@ -53,6 +78,13 @@ func initializeDB() {
 			log.Fatal("Failed to initialize default config.", err)
 		}
 	}
+	// Initialize default emojis.
+	if DB.First(&Emoji{}).RowsAffected == 0 {
+		log.Info("Initializing default emojis.")
+		if err := DB.Create(defaultEmojis()).Error; err != nil {
+			log.Fatal("Failed to initialize default emojis.", err)
+		}
+	}
 	// Initialize default tag.
 	if DB.First(&Tag{}).RowsAffected == 0 {
 		log.Info("Initializing default tag.")
@@ -61,3 +93,77 @@ func initializeDB() {
 		}
 	}
 }
+
+// defaultEmojis returns the unicode emojis that used to be hard-coded, and the
+// stickers shipped with the frontend which are disabled until an admin enables them.
+func defaultEmojis() []Emoji {
+	var emojis []Emoji
+	for i, v := range []string{"👍", "👎", "🤣", "😭", "😓", "😬", "🥳", "😨", "😠", "💩", "💖", "🐵", "❓", "🫂", "🔘", "👅", "🥺", "👻", "😅", "🌹"} {
+		emojis = append(emojis, Emoji{Value: v, Type: EmojiTypeUnicode, Enabled: true, SortOrder: i})
+	}
+	stickers := []struct{ name, file string }{
+		{"跑了", "paole"}, {"鞠躬", "jugong"}, {"摇你", "yaoni"}, {"愤怒", "fennu"}, {"猴", "hou"},
+		{"NO", "no"}, {"贴贴", "tietie"}, {"呆", "dai"}, {"唔唔", "wuwu"}, {"啊这", "azhe"},
+		{"失落", "shiluo"}, {"神气", "shenqi"}, {"怎么这样", "zenmezhyang"}, {"睡觉", "shuijiao"}, {"爆", "bao"},
+	}
+	for i, s := range stickers {
+		emojis = append(emojis, Emoji{
+			Value:     "[轴伊Joi收藏集动态表情包_" + s.name + "]",
+			Name:      s.name,
+			Type:      EmojiTypeImage,
+			ImageURL:  "/joi-emojis/" + s.file + ".webp",
+			SortOrder: 100 + i,
+		})
+	}
+	return emojis
+}
+
+// migrateEmojis moves the legacy JSON encoded questions.emojis column into the
+// emoji_counts table, migrated rows are cleared so it only runs once.
+func migrateEmojis() error {
+	if !DB.Migrator().HasColumn(&Question{}, "emojis") {
+		return nil
+	}
+	var rows []struct {
+		ID     int
+		Emojis string
+	}
+	err := DB.Table("questions").Select("id, emojis").Where("emojis is not null and emojis <> ''").Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	log.Info("Migrating emojis of ", len(rows), " questions.")
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			var emojis []struct {
+				Value string `json:"value"`
+				Count int    `json:"count"`
+			}
+			if err := json.Unmarshal([]byte(row.Emojis), &emojis); err != nil {
+				log.Warn("Skipping invalid emojis of question ", row.ID, ": ", err)
+				continue
+			}
+			for _, e := range emojis {
+				if e.Count <= 0 {
+					continue
+				}
+				err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&EmojiCount{
+					QuestionID: row.ID,
+					Emoji:      e.Value,
+					Count:      e.Count,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			// Rows that failed to parse are kept so that they can be fixed
+			if err := tx.Table("questions").Where("id = ?", row.ID).Update("emojis", "").Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/speps/go-hashids/v2"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+var hashID *hashids.HashID
+var hashIDOnce sync.Once
+
+var ErrInvalidPublicID = errors.New("invalid public id")
+
+// publicIDs returns the encoder for public question ids, salted with
+// security.id_salt so that ids of unpublished questions can not be guessed.
+func publicIDs() *hashids.HashID {
+	hashIDOnce.Do(func() {
+		data := hashids.NewData()
+		data.Salt = viper.GetString("security.id_salt")
+		data.MinLength = 8
+		var err error
+		hashID, err = hashids.NewWithData(data)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+	return hashID
+}
+
+// EncodePublicID returns the non-sequential public identifier of a question.
+func EncodePublicID(id uint) string {
+	s, err := publicIDs().EncodeInt64([]int64{int64(id)})
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+// DecodePublicID returns the question id of a public identifier.
+func DecodePublicID(s string) (uint, error) {
+	ids, err := publicIDs().DecodeInt64WithError(s)
+	if err != nil || len(ids) != 1 || ids[0] <= 0 {
+		return 0, ErrInvalidPublicID
+	}
+	return uint(ids[0]), nil
+}
+
+func (q *Question) AfterFind(tx *gorm.DB) error {
+	q.PublicID = EncodePublicID(q.ID)
+	return nil
+}
+
+func (q *Question) AfterCreate(tx *gorm.DB) error {
+	q.PublicID = EncodePublicID(q.ID)
+	return nil
+}
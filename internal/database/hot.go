@@ -0,0 +1,117 @@
+package database
+
+import (
+	"math"
+	"time"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// Hot scores are kept in log space: hot = ln Σ exp((t_i - hotEpoch) / tau), where
+// t_i are the creation time of the question and the times of its reactions. Every
+// term decays by the same factor as time passes, so ordering by the stored value
+// equals ordering by the time-decayed score at any moment, and the score only has
+// to be touched when a reaction is added or removed.
+var hotEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// hotTau returns the decay time constant in seconds, derived from hot.half_life
+// in hours (24 by default).
+func hotTau() float64 {
+	halfLife := viper.GetFloat64("hot.half_life")
+	if halfLife <= 0 {
+		halfLife = 24
+	}
+	return halfLife * 3600 / math.Ln2
+}
+
+// HotTerm is the log-space contribution of an event happening at t.
+func HotTerm(t time.Time) float64 {
+	return t.Sub(hotEpoch).Seconds() / hotTau()
+}
+
+// hotAdd returns ln(exp(hot) + exp(term)) without overflowing.
+func hotAdd(hot float64, term float64) float64 {
+	if term > hot {
+		hot, term = term, hot
+	}
+	return hot + math.Log1p(math.Exp(term-hot))
+}
+
+// hotSub returns ln(exp(hot) - exp(term)), the creation term of a question is
+// never removed so the result is always defined for valid inputs.
+func hotSub(hot float64, term float64) float64 {
+	if term >= hot {
+		return hot
+	}
+	return hot + math.Log1p(-math.Exp(term-hot))
+}
+
+func (q *Question) BeforeCreate(tx *gorm.DB) error {
+	if q.Hot == 0 {
+		createdAt := q.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		q.Hot = HotTerm(createdAt)
+	}
+	return nil
+}
+
+// AddReactionScore updates the reaction total and hot score of a question after
+// a reaction made at t was added (delta 1) or removed (delta -1). The likes update
+// comes first so the row is locked before the hot score is read and written back.
+func AddReactionScore(tx *gorm.DB, questionID int, delta int, t time.Time) error {
+	err := tx.Model(&Question{}).Where("id = ?", questionID).UpdateColumn("likes", gorm.Expr("likes + ?", delta)).Error
+	if err != nil {
+		return err
+	}
+	var hot float64
+	if err := tx.Model(&Question{}).Where("id = ?", questionID).Select("hot").Scan(&hot).Error; err != nil {
+		return err
+	}
+	if delta > 0 {
+		hot = hotAdd(hot, HotTerm(t))
+	} else {
+		hot = hotSub(hot, HotTerm(t))
+	}
+	return tx.Model(&Question{}).Where("id = ?", questionID).UpdateColumn("hot", hot).Error
+}
+
+// backfillHot computes the reaction totals and hot scores of questions created
+// before scores were maintained, their reactions are treated as happening when
+// the question was created.
+func backfillHot() error {
+	var questions []Question
+	if err := DB.Select("id, created_at").Where("hot is null or hot = 0").Find(&questions).Error; err != nil {
+		return err
+	}
+	if len(questions) == 0 {
+		return nil
+	}
+	var totals []struct {
+		QuestionID int
+		Total      int
+	}
+	err := DB.Model(&EmojiCount{}).Select("question_id, sum(count) as total").Group("question_id").Scan(&totals).Error
+	if err != nil {
+		return err
+	}
+	likes := make(map[int]int, len(totals))
+	for _, t := range totals {
+		likes[t.QuestionID] = t.Total
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, q := range questions {
+			total := likes[int(q.ID)]
+			err := tx.Model(&Question{}).Where("id = ?", q.ID).UpdateColumns(map[string]interface{}{
+				"likes": total,
+				"hot":   HotTerm(q.CreatedAt) + math.Log1p(float64(total)),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
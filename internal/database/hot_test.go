@@ -0,0 +1,72 @@
+package database
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHotAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		hot  float64
+		term float64
+		want float64
+	}{
+		{"equal terms", 0, 0, math.Ln2},
+		{"larger term", 1, 3, 3 + math.Log1p(math.Exp(-2))},
+		{"smaller term", 3, 1, 3 + math.Log1p(math.Exp(-2))},
+		{"negligible term", 1000, 0, 1000},
+		{"large values", 50000, 50000, 50000 + math.Ln2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hotAdd(tt.hot, tt.term)
+			if math.IsInf(got, 0) || math.IsNaN(got) || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("hotAdd(%v, %v) = %v, want %v", tt.hot, tt.term, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHotSub(t *testing.T) {
+	tests := []struct {
+		name string
+		hot  float64
+		term float64
+		want float64
+	}{
+		{"removes an added term", math.Ln2, 0, 0},
+		{"term not smaller than hot", 2, 2, 2},
+		{"term larger than hot", 2, 5, 2},
+		{"large values", 50000 + math.Ln2, 50000, 50000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hotSub(tt.hot, tt.term)
+			if math.IsInf(got, 0) || math.IsNaN(got) || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("hotSub(%v, %v) = %v, want %v", tt.hot, tt.term, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHotAddSubRoundTrip(t *testing.T) {
+	created := HotTerm(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	reactions := []float64{
+		HotTerm(time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)),
+		HotTerm(time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)),
+		HotTerm(time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)),
+	}
+	hot := created
+	for _, r := range reactions {
+		hot = hotAdd(hot, r)
+	}
+	for i := len(reactions) - 1; i >= 0; i-- {
+		hot = hotSub(hot, reactions[i])
+	}
+	// Removing a term much larger than the rest cancels most digits
+	if math.Abs(hot-created) > 1e-6 {
+		t.Errorf("hot after removing every reaction = %v, want %v", hot, created)
+	}
+}
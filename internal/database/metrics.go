@@ -0,0 +1,39 @@
+package database
+
+import (
+	"errors"
+
+	"joiask-backend/internal/metrics"
+
+	"gorm.io/gorm"
+)
+
+// countErrors returns a callback counting failed operations, a missing record
+// is not an error.
+func countErrors(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			metrics.DBErrors.WithLabelValues(operation).Inc()
+		}
+	}
+}
+
+func registerMetricsCallbacks() error {
+	callbacks := DB.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("metrics:create", countErrors("create")); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("gorm:query").Register("metrics:query", countErrors("query")); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("metrics:update", countErrors("update")); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("metrics:delete", countErrors("delete")); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:row").Register("metrics:row", countErrors("row")); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("metrics:raw", countErrors("raw"))
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"time"
 )
 
@@ -13,6 +14,31 @@ type Tag struct {
 	BaseModel
 	TagName     string `gorm:"unique" json:"tag_name"`
 	Description string `json:"description"`
+	// ParentID is the parent tag, 0 for top level tags
+	ParentID   int    `gorm:"index;default:0" json:"parent_id"`
+	SortOrder  int    `gorm:"index;default:0" json:"sort_order"`
+	CoverImage string `json:"cover_image"`
+	// Window limits submissions to the tag in addition to the box window
+	Window   SubmissionWindow `gorm:"embedded;embeddedPrefix:window_" json:"window"`
+	Settings TagSettings      `gorm:"embedded" json:"settings"`
+}
+
+// TagSettings are the submission rules of a tag, zero values apply no limit.
+type TagSettings struct {
+	ImagesDisabled   bool   `gorm:"default:false" json:"images_disabled"`
+	MaxImages        int    `gorm:"default:0" json:"max_images"`
+	MaxContentLength int    `gorm:"default:0" json:"max_content_length"`
+	AutoPublish      bool   `gorm:"default:false" json:"auto_publish"`
+	IsHidden         bool   `gorm:"default:false" json:"is_hidden"`
+	Placeholder      string `json:"placeholder"`
+}
+
+// Validate checks the limits are not negative.
+func (s TagSettings) Validate() error {
+	if s.MaxImages < 0 || s.MaxContentLength < 0 {
+		return errors.New("limits must not be negative")
+	}
+	return nil
 }
 
 type Question struct {
@@ -27,7 +53,26 @@ type Question struct {
 	IsRainbow bool   `gorm:"index" json:"is_rainbow"`
 	IsArchive bool   `gorm:"index" json:"is_archive"`
 	IsPublish bool   `gorm:"index" json:"is_publish"`
-	Emojis    string `json:"emojis"`
+	IsShadow  bool   `gorm:"index;default:false" json:"is_shadow"`
+	// Emojis is the JSON encoded list of EmojiCount, it is filled by the
+	// controller and no longer stored on the question row.
+	Emojis string `gorm:"-" json:"emojis"`
+	// SubmitterHash is the salted hash of the submitter IP, kept for moderation.
+	SubmitterHash string `gorm:"index" json:"-"`
+	// SubmitterVisitor is the salted hash of the submitter visitor cookie.
+	SubmitterVisitor string `gorm:"index" json:"-"`
+	// Hot is the time-decayed reaction score, Likes holds the reaction total.
+	Hot float64 `gorm:"index" json:"hot"`
+	// PublicID is the non-sequential identifier used in permalinks.
+	PublicID string `gorm:"-" json:"public_id"`
+	// Snippet is the highlighted search match, only set in search results.
+	Snippet string `gorm:"-" json:"snippet,omitempty"`
+	// SessionID is the Q&A session open when the question was submitted, 0 if none.
+	SessionID int `gorm:"index;default:0" json:"session_id"`
+	// PublishedAt and ArchivedAt are set when the question is published or
+	// archived, they are empty for questions changed before they were kept.
+	PublishedAt *time.Time `gorm:"index" json:"published_at"`
+	ArchivedAt  *time.Time `gorm:"index" json:"archived_at"`
 }
 
 type LikeRecord struct {
@@ -37,25 +82,116 @@ type LikeRecord struct {
 	Question   Question `json:"question"`
 }
 
+// Reaction is an emoji held by a visitor on a question.
+type Reaction struct {
+	BaseModel
+	QuestionID int    `gorm:"uniqueIndex:idx_reaction" json:"question_id"`
+	Visitor    string `gorm:"size:64;uniqueIndex:idx_reaction" json:"-"`
+	Emoji      string `gorm:"size:64;uniqueIndex:idx_reaction" json:"emoji"`
+}
+
+// EmojiCount is the number of reactions of an emoji on a question.
+type EmojiCount struct {
+	QuestionID int    `gorm:"primaryKey;autoIncrement:false" json:"question_id"`
+	Emoji      string `gorm:"primaryKey;size:64" json:"emoji"`
+	Count      int    `json:"count"`
+}
+
+const (
+	EmojiTypeUnicode = "unicode"
+	EmojiTypeImage   = "image"
+)
+
+// Emoji is an entry of the reaction catalog, either a unicode emoji or an
+// uploaded image identified by Value.
+type Emoji struct {
+	BaseModel
+	Value     string `gorm:"size:64;uniqueIndex" json:"value"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	ImageURL  string `json:"image_url"`
+	Enabled   bool   `gorm:"index" json:"enabled"`
+	SortOrder int    `gorm:"index" json:"sort_order"`
+}
+
+// Session is a Q&A stream, questions submitted while it is open belong to it.
+type Session struct {
+	BaseModel
+	Title   string     `json:"title"`
+	StartAt time.Time  `gorm:"index" json:"start_at"`
+	EndAt   *time.Time `gorm:"index" json:"end_at"`
+	// TagID limits the session to questions of a tag, 0 for all tags
+	TagID int `gorm:"index" json:"tag_id"`
+}
+
 type Admin struct {
 	BaseModel
 	Username string `gorm:"unique" json:"username"`
 	Password string `json:"-"`
 }
 
+// AuditLog records an administrative operation, Detail is JSON.
+type AuditLog struct {
+	BaseModel
+	Action    string `gorm:"index" json:"action"`
+	Detail    string `json:"detail"`
+	CreatedBy uint   `json:"created_by"`
+}
+
+// Ban blocks an IP, a CIDR range or a hashed submitter IP.
+type Ban struct {
+	BaseModel
+	Target     string     `gorm:"index" json:"target"`
+	IPHash     string     `gorm:"index" json:"-"`
+	QuestionID int        `json:"question_id"`
+	Reason     string     `json:"reason"`
+	CreatedBy  uint       `json:"created_by"`
+	ExpiresAt  *time.Time `gorm:"index" json:"expires_at"`
+}
+
+// ShadowBan silently moves submissions of a submitter into a hidden bucket.
+// A submission matching either the IP hash or the visitor hash is hidden.
+type ShadowBan struct {
+	BaseModel
+	Fingerprint string `gorm:"uniqueIndex" json:"-"`
+	Visitor     string `gorm:"index" json:"-"`
+	QuestionID  int    `json:"question_id"`
+	Reason      string `json:"reason"`
+	CreatedBy   uint   `json:"created_by"`
+}
+
 type Config struct {
 	BaseModel
 	Announcement string `json:"announcement"`
+	// Question currently answered on stream, 0 if none
+	OnAirQuestionID uint `json:"on_air_question_id"`
+	// Window decides when the box accepts submissions
+	Window SubmissionWindow `gorm:"embedded;embeddedPrefix:window_" json:"window"`
+	// Submission is the current state of Window, filled by the controller
+	Submission *SubmissionState `gorm:"-" json:"submission,omitempty"`
 }
 
-func (t Tag) Json() map[string]interface{} {
-	var count int64
-	DB.Model(&Question{}).Where("tag_id = ?", t.ID).Count(&count)
-	return map[string]interface{}{
+// Json returns the tag for the tag list, only admins see the counts of
+// questions which are not published.
+func (t Tag) Json(counts TagCounts, box SubmissionWindow, admin bool) map[string]interface{} {
+	submission := SubmissionStateOf(time.Now(), box, t.Window)
+	m := map[string]interface{}{
 		"id":             t.ID,
 		"tag_name":       t.TagName,
 		"description":    t.Description,
-		"question_count": count,
+		"parent_id":      t.ParentID,
+		"sort_order":     t.SortOrder,
+		"cover_image":    t.CoverImage,
+		"question_count": counts.Published,
 		"created_at":     t.CreatedAt,
+		"window":         t.Window,
+		"submission":     submission,
+		"accepting":      submission.Open,
+		"settings":       t.Settings,
+	}
+	if admin {
+		m["question_count"] = counts.Total
+		m["counts"] = counts
 	}
+	return m
 }
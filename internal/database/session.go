@@ -0,0 +1,41 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StoredTime converts t to the zone times are stored in. SQLite stores times as
+// text and compares them as strings, so every time written or bound must use
+// the zone of created_at, which is the process zone.
+func StoredTime(t time.Time) time.Time {
+	return t.In(time.Local)
+}
+
+// OpenSession returns the session open at t for questions of the tag, a
+// session scoped to the tag is preferred over one covering all tags. The
+// returned session has ID 0 if none is open.
+func OpenSession(tagID int, t time.Time) (Session, error) {
+	var session Session
+	t = StoredTime(t)
+	err := DB.Where("start_at <= ? and (end_at is null or end_at > ?)", t, t).
+		Where("tag_id = 0 or tag_id = ?", tagID).
+		Order("tag_id desc").Order("start_at desc").
+		Limit(1).Find(&session).Error
+	return session, err
+}
+
+// LinkSessionQuestions assigns the questions submitted during the session
+// which do not belong to any session yet, for sessions created after the
+// stream has started.
+func LinkSessionQuestions(tx *gorm.DB, session Session) error {
+	q := tx.Model(&Question{}).Where("session_id = 0 and created_at >= ?", StoredTime(session.StartAt))
+	if session.EndAt != nil {
+		q = q.Where("created_at < ?", StoredTime(*session.EndAt))
+	}
+	if session.TagID > 0 {
+		q = q.Where("tag_id = ?", session.TagID)
+	}
+	return q.UpdateColumn("session_id", session.ID).Error
+}
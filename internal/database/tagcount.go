@@ -0,0 +1,118 @@
+package database
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TagCounts are the numbers of questions of a tag by state.
+type TagCounts struct {
+	Total     int64 `json:"total"`
+	Published int64 `json:"published"`
+	Pending   int64 `json:"pending"`
+	Archived  int64 `json:"archived"`
+	Rainbow   int64 `json:"rainbow"`
+}
+
+// tagCountTTL bounds how long counts stay cached, as a write invalidating the
+// cache before its transaction commits lets a concurrent read cache old counts.
+const tagCountTTL = time.Minute
+
+type tagCountCache struct {
+	mutex    sync.Mutex
+	loadedAt time.Time
+	counts   map[int]TagCounts
+}
+
+var tagCounts tagCountCache
+
+func (t *tagCountCache) invalidate() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.counts = nil
+}
+
+// CountTags returns the question counts of every tag, computed with a single
+// grouped query and cached until questions are written.
+func CountTags() (map[int]TagCounts, error) {
+	tagCounts.mutex.Lock()
+	defer tagCounts.mutex.Unlock()
+	if tagCounts.counts != nil && time.Since(tagCounts.loadedAt) < tagCountTTL {
+		return tagCounts.counts, nil
+	}
+	var rows []struct {
+		TagID int
+		TagCounts
+	}
+	err := DB.Model(&Question{}).
+		Select("tag_id, count(*) as total, " +
+			"COALESCE(SUM(CASE WHEN is_publish AND NOT is_shadow THEN 1 ELSE 0 END), 0) as published, " +
+			"COALESCE(SUM(CASE WHEN NOT is_publish THEN 1 ELSE 0 END), 0) as pending, " +
+			"COALESCE(SUM(CASE WHEN is_archive THEN 1 ELSE 0 END), 0) as archived, " +
+			"COALESCE(SUM(CASE WHEN is_rainbow THEN 1 ELSE 0 END), 0) as rainbow").
+		Group("tag_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[int]TagCounts, len(rows))
+	for _, r := range rows {
+		counts[r.TagID] = r.TagCounts
+	}
+	tagCounts.counts = counts
+	tagCounts.loadedAt = time.Now()
+	return counts, nil
+}
+
+// countedColumns are the question columns the counts depend on
+var countedColumns = map[string]bool{
+	"tag_id":     true,
+	"is_publish": true,
+	"is_archive": true,
+	"is_rainbow": true,
+	"is_shadow":  true,
+}
+
+func isQuestions(db *gorm.DB) bool {
+	return db.Statement.Schema != nil && db.Statement.Schema.Table == "questions" || db.Statement.Table == "questions"
+}
+
+// invalidateTagCounts drops the cached counts after questions are created or
+// deleted.
+func invalidateTagCounts(db *gorm.DB) {
+	if isQuestions(db) {
+		tagCounts.invalidate()
+	}
+}
+
+// invalidateUpdatedTagCounts drops the cached counts after an update to
+// questions which sets a counted column, so that reactions updating likes
+// and hot scores keep the cache.
+func invalidateUpdatedTagCounts(db *gorm.DB) {
+	if !isQuestions(db) {
+		return
+	}
+	set, ok := db.Statement.Clauses["SET"].Expression.(clause.Set)
+	if !ok {
+		tagCounts.invalidate()
+		return
+	}
+	for _, assignment := range set {
+		if countedColumns[assignment.Column.Name] {
+			tagCounts.invalidate()
+			return
+		}
+	}
+}
+
+func registerTagCountCallbacks() error {
+	if err := DB.Callback().Create().After("gorm:create").Register("tag_counts:create", invalidateTagCounts); err != nil {
+		return err
+	}
+	if err := DB.Callback().Update().After("gorm:update").Register("tag_counts:update", invalidateUpdatedTagCounts); err != nil {
+		return err
+	}
+	return DB.Callback().Delete().After("gorm:delete").Register("tag_counts:delete", invalidateTagCounts)
+}
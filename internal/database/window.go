@@ -0,0 +1,234 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	WindowOpen      = "open"
+	WindowClosed    = "closed"
+	WindowScheduled = "scheduled"
+)
+
+// Location returns the time zone of schedules and day boundaries, set by the
+// timezone config key and defaulting to the local time zone.
+func Location() *time.Location {
+	name := viper.GetString("timezone")
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// WeeklyRange is a recurring weekly opening, Day is 0 for Sunday and Start
+// and End are "15:04" clock times. An End not after Start ends the next day.
+type WeeklyRange struct {
+	Day   int    `json:"day"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Weekly is a weekly schedule, stored as JSON.
+type Weekly []WeeklyRange
+
+func (w Weekly) Value() (driver.Value, error) {
+	if len(w) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(w)
+	return string(b), err
+}
+
+func (w *Weekly) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("unsupported weekly schedule type %T", value)
+	}
+	*w = nil
+	if len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, w)
+}
+
+// SubmissionWindow decides when submissions are accepted. A scheduled window
+// is open between OpenAt and CloseAt, and within the weekly ranges if any.
+type SubmissionWindow struct {
+	// Mode is open, closed or scheduled, empty means open
+	Mode    string     `json:"mode"`
+	OpenAt  *time.Time `json:"open_at"`
+	CloseAt *time.Time `json:"close_at"`
+	Weekly  Weekly     `gorm:"type:text" json:"weekly"`
+}
+
+// SubmissionState is the state of a window at a moment, NextChange is nil if
+// the state never changes.
+type SubmissionState struct {
+	Open       bool       `json:"open"`
+	NextChange *time.Time `json:"next_change"`
+}
+
+// parseClock returns the minutes after midnight of a "15:04" clock time.
+func parseClock(v string) (int, error) {
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Validate checks the mode, the dates and the weekly ranges.
+func (w SubmissionWindow) Validate() error {
+	switch w.Mode {
+	case "", WindowOpen, WindowClosed, WindowScheduled:
+	default:
+		return errors.New("invalid mode")
+	}
+	if w.OpenAt != nil && w.CloseAt != nil && !w.CloseAt.After(*w.OpenAt) {
+		return errors.New("close time must be after open time")
+	}
+	for _, r := range w.Weekly {
+		if r.Day < 0 || r.Day > 6 {
+			return errors.New("invalid weekday")
+		}
+		if _, err := parseClock(r.Start); err != nil {
+			return errors.New("invalid start time")
+		}
+		if _, err := parseClock(r.End); err != nil {
+			return errors.New("invalid end time")
+		}
+	}
+	return nil
+}
+
+// weeklySpans returns the weekly openings starting from the day before t up
+// to a week after it.
+func (w SubmissionWindow) weeklySpans(t time.Time) [][2]time.Time {
+	loc := Location()
+	local := t.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	var spans [][2]time.Time
+	for d := -1; d <= 7; d++ {
+		day := today.AddDate(0, 0, d)
+		for _, r := range w.Weekly {
+			if int(day.Weekday()) != r.Day {
+				continue
+			}
+			start, err1 := parseClock(r.Start)
+			end, err2 := parseClock(r.End)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			// Built from the date so openings keep their clock time across DST changes
+			from := time.Date(day.Year(), day.Month(), day.Day(), start/60, start%60, 0, 0, loc)
+			to := time.Date(day.Year(), day.Month(), day.Day(), end/60, end%60, 0, 0, loc)
+			if end <= start {
+				to = to.AddDate(0, 0, 1)
+			}
+			spans = append(spans, [2]time.Time{from, to})
+		}
+	}
+	return spans
+}
+
+// IsOpen reports whether submissions are accepted at t.
+func (w SubmissionWindow) IsOpen(t time.Time) bool {
+	switch w.Mode {
+	case WindowClosed:
+		return false
+	case WindowScheduled:
+	default:
+		return true
+	}
+	if w.OpenAt != nil && t.Before(*w.OpenAt) {
+		return false
+	}
+	if w.CloseAt != nil && !t.Before(*w.CloseAt) {
+		return false
+	}
+	if len(w.Weekly) == 0 {
+		return true
+	}
+	for _, s := range w.weeklySpans(t) {
+		if !t.Before(s[0]) && t.Before(s[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// changes returns the moments after t where the window may open or close.
+func (w SubmissionWindow) changes(t time.Time) []time.Time {
+	if w.Mode != WindowScheduled {
+		return nil
+	}
+	var list []time.Time
+	for _, v := range []*time.Time{w.OpenAt, w.CloseAt} {
+		if v != nil && v.After(t) {
+			list = append(list, *v)
+		}
+	}
+	spans := w.weeklySpans(t)
+	if w.OpenAt != nil && w.OpenAt.After(t) {
+		// The first weekly opening may be long after t
+		spans = append(spans, w.weeklySpans(*w.OpenAt)...)
+	}
+	for _, s := range spans {
+		for _, v := range s {
+			if v.After(t) {
+				list = append(list, v)
+			}
+		}
+	}
+	return list
+}
+
+// BoxWindow returns the submission window of the whole box.
+func BoxWindow() SubmissionWindow {
+	var config Config
+	DB.First(&config)
+	return config.Window
+}
+
+// SubmissionStateOf returns the state of the windows combined, submissions are
+// accepted only while every window is open.
+func SubmissionStateOf(t time.Time, windows ...SubmissionWindow) SubmissionState {
+	isOpen := func(t time.Time) bool {
+		for _, w := range windows {
+			if !w.IsOpen(t) {
+				return false
+			}
+		}
+		return true
+	}
+	var changes []time.Time
+	for _, w := range windows {
+		changes = append(changes, w.changes(t)...)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Before(changes[j]) })
+	state := SubmissionState{Open: isOpen(t)}
+	for i := range changes {
+		if isOpen(changes[i]) != state.Open {
+			state.NextChange = &changes[i]
+			break
+		}
+	}
+	return state
+}
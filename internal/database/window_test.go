@@ -0,0 +1,163 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// setTimezone sets the timezone config key for the duration of a test.
+func setTimezone(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("timezone", name)
+	t.Cleanup(func() { viper.Set("timezone", "") })
+	return loc
+}
+
+// at parses a "2006-01-02 15:04" time in loc.
+func at(t *testing.T, loc *time.Location, v string) time.Time {
+	t.Helper()
+	ts, err := time.ParseInLocation("2006-01-02 15:04", v, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestIsOpen(t *testing.T) {
+	loc := setTimezone(t, "Asia/Shanghai")
+	// 2024-01-01 is a Monday
+	weekday := Weekly{{Day: 1, Start: "09:00", End: "17:00"}}
+	overnight := Weekly{{Day: 5, Start: "22:00", End: "02:00"}}
+	tests := []struct {
+		name   string
+		window SubmissionWindow
+		at     time.Time
+		want   bool
+	}{
+		{"empty mode", SubmissionWindow{}, at(t, loc, "2024-01-01 03:00"), true},
+		{"open", SubmissionWindow{Mode: WindowOpen, Weekly: weekday}, at(t, loc, "2024-01-02 03:00"), true},
+		{"closed", SubmissionWindow{Mode: WindowClosed}, at(t, loc, "2024-01-01 10:00"), false},
+		{"scheduled without limits", SubmissionWindow{Mode: WindowScheduled}, at(t, loc, "2024-01-01 03:00"), true},
+		{"before open_at", SubmissionWindow{Mode: WindowScheduled, OpenAt: ptr(at(t, loc, "2024-01-01 10:00"))}, at(t, loc, "2024-01-01 09:59"), false},
+		{"at open_at", SubmissionWindow{Mode: WindowScheduled, OpenAt: ptr(at(t, loc, "2024-01-01 10:00"))}, at(t, loc, "2024-01-01 10:00"), true},
+		{"before close_at", SubmissionWindow{Mode: WindowScheduled, CloseAt: ptr(at(t, loc, "2024-01-01 10:00"))}, at(t, loc, "2024-01-01 09:59"), true},
+		{"at close_at", SubmissionWindow{Mode: WindowScheduled, CloseAt: ptr(at(t, loc, "2024-01-01 10:00"))}, at(t, loc, "2024-01-01 10:00"), false},
+		{"before weekly start", SubmissionWindow{Mode: WindowScheduled, Weekly: weekday}, at(t, loc, "2024-01-01 08:59"), false},
+		{"at weekly start", SubmissionWindow{Mode: WindowScheduled, Weekly: weekday}, at(t, loc, "2024-01-01 09:00"), true},
+		{"before weekly end", SubmissionWindow{Mode: WindowScheduled, Weekly: weekday}, at(t, loc, "2024-01-01 16:59"), true},
+		{"at weekly end", SubmissionWindow{Mode: WindowScheduled, Weekly: weekday}, at(t, loc, "2024-01-01 17:00"), false},
+		{"other weekday", SubmissionWindow{Mode: WindowScheduled, Weekly: weekday}, at(t, loc, "2024-01-02 10:00"), false},
+		{"next week", SubmissionWindow{Mode: WindowScheduled, Weekly: weekday}, at(t, loc, "2024-01-08 10:00"), true},
+		{"overnight before start", SubmissionWindow{Mode: WindowScheduled, Weekly: overnight}, at(t, loc, "2024-01-05 21:59"), false},
+		{"overnight after midnight", SubmissionWindow{Mode: WindowScheduled, Weekly: overnight}, at(t, loc, "2024-01-06 01:59"), true},
+		{"overnight at end", SubmissionWindow{Mode: WindowScheduled, Weekly: overnight}, at(t, loc, "2024-01-06 02:00"), false},
+		{"other zone inside", SubmissionWindow{Mode: WindowScheduled, Weekly: weekday}, at(t, time.UTC, "2024-01-01 01:00"), true},
+		{"other zone outside", SubmissionWindow{Mode: WindowScheduled, Weekly: weekday}, at(t, time.UTC, "2024-01-01 09:00"), false},
+		{
+			"weekly within dates",
+			SubmissionWindow{Mode: WindowScheduled, OpenAt: ptr(at(t, loc, "2024-01-03 00:00")), Weekly: weekday},
+			at(t, loc, "2024-01-01 10:00"),
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.IsOpen(tt.at); got != tt.want {
+				t.Errorf("IsOpen(%v) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsOpenAcrossDST(t *testing.T) {
+	loc := setTimezone(t, "America/New_York")
+	// Clocks move forward on 2024-03-10 and back on 2024-11-03, both Sundays
+	window := SubmissionWindow{Mode: WindowScheduled, Weekly: Weekly{{Day: 1, Start: "09:00", End: "10:00"}}}
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"before spring change", at(t, time.UTC, "2024-03-04 14:30"), true},
+		{"after spring change", at(t, time.UTC, "2024-03-11 13:30"), true},
+		{"after spring change at the old time", at(t, time.UTC, "2024-03-11 14:30"), false},
+		{"after fall change", at(t, time.UTC, "2024-11-04 14:30"), true},
+		{"after fall change at the old time", at(t, time.UTC, "2024-11-04 13:30"), false},
+		{"local clock", at(t, loc, "2024-11-04 09:59"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := window.IsOpen(tt.at); got != tt.want {
+				t.Errorf("IsOpen(%v) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubmissionStateOf(t *testing.T) {
+	loc := setTimezone(t, "Asia/Shanghai")
+	weekday := SubmissionWindow{Mode: WindowScheduled, Weekly: Weekly{{Day: 1, Start: "09:00", End: "17:00"}}}
+	tests := []struct {
+		name    string
+		windows []SubmissionWindow
+		at      time.Time
+		open    bool
+		next    *time.Time
+	}{
+		{"no windows", nil, at(t, loc, "2024-01-01 08:00"), true, nil},
+		{"always open", []SubmissionWindow{{}}, at(t, loc, "2024-01-01 08:00"), true, nil},
+		{"closed", []SubmissionWindow{{Mode: WindowClosed}}, at(t, loc, "2024-01-01 08:00"), false, nil},
+		{"before opening", []SubmissionWindow{weekday}, at(t, loc, "2024-01-01 08:00"), false, ptr(at(t, loc, "2024-01-01 09:00"))},
+		{"while open", []SubmissionWindow{weekday}, at(t, loc, "2024-01-01 10:00"), true, ptr(at(t, loc, "2024-01-01 17:00"))},
+		{"after closing", []SubmissionWindow{weekday}, at(t, loc, "2024-01-01 17:00"), false, ptr(at(t, loc, "2024-01-08 09:00"))},
+		{
+			"closed box",
+			[]SubmissionWindow{{Mode: WindowClosed}, weekday},
+			at(t, loc, "2024-01-01 10:00"),
+			false,
+			nil,
+		},
+		{
+			"box closes first",
+			[]SubmissionWindow{{Mode: WindowScheduled, CloseAt: ptr(at(t, loc, "2024-01-01 12:00"))}, weekday},
+			at(t, loc, "2024-01-01 10:00"),
+			true,
+			ptr(at(t, loc, "2024-01-01 12:00")),
+		},
+		{
+			"opening after open_at",
+			[]SubmissionWindow{{
+				Mode:   WindowScheduled,
+				OpenAt: ptr(at(t, loc, "2024-02-01 00:00")),
+				Weekly: weekday.Weekly,
+			}},
+			at(t, loc, "2024-01-01 08:00"),
+			false,
+			ptr(at(t, loc, "2024-02-05 09:00")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SubmissionStateOf(tt.at, tt.windows...)
+			if got.Open != tt.open {
+				t.Errorf("Open = %v, want %v", got.Open, tt.open)
+			}
+			switch {
+			case tt.next == nil && got.NextChange != nil:
+				t.Errorf("NextChange = %v, want nil", got.NextChange)
+			case tt.next != nil && (got.NextChange == nil || !got.NextChange.Equal(*tt.next)):
+				t.Errorf("NextChange = %v, want %v", got.NextChange, tt.next)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var mutex sync.Mutex
+var loggers = make(map[string]*logrus.Logger)
+
+// Logger returns the logger of a subsystem, every entry carries the subsystem
+// name. Its level is set by log.levels.<subsystem>, or log.level by default.
+func Logger(subsystem string) *logrus.Entry {
+	mutex.Lock()
+	defer mutex.Unlock()
+	l, ok := loggers[subsystem]
+	if !ok {
+		l = logrus.New()
+		configure(subsystem, l)
+		loggers[subsystem] = l
+	}
+	return l.WithField("subsystem", subsystem)
+}
+
+// Init applies the log config to the standard logger and every subsystem
+// logger, it is called again after the config is loaded.
+func Init() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	configure("", logrus.StandardLogger())
+	for subsystem, l := range loggers {
+		configure(subsystem, l)
+	}
+}
+
+func configure(subsystem string, l *logrus.Logger) {
+	if viper.GetString("log.format") == "json" {
+		l.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		l.SetFormatter(&logrus.TextFormatter{})
+	}
+	name := viper.GetString("log.level")
+	if subsystem != "" && viper.IsSet("log.levels."+subsystem) {
+		name = viper.GetString("log.levels." + subsystem)
+	}
+	level, err := logrus.ParseLevel(name)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	l.SetLevel(level)
+}
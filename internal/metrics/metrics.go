@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
+)
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "joiask_http_requests_total",
+		Help: "HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "joiask_http_request_duration_seconds",
+		Help:    "HTTP request latency by route, streaming connections are excluded.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// EventsBroadcast counts realtime events sent to clients by event type.
+	EventsBroadcast = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "joiask_events_broadcast_total",
+		Help: "Realtime events broadcast by event type.",
+	}, []string{"type"})
+	// ClientsDropped counts realtime clients removed because they could not keep up.
+	ClientsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "joiask_realtime_clients_dropped_total",
+		Help: "Realtime clients dropped by broadcast by transport.",
+	}, []string{"transport"})
+
+	// UploadBytes counts bytes uploaded by storage backend.
+	UploadBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "joiask_storage_upload_bytes_total",
+		Help: "Bytes uploaded by storage backend.",
+	}, []string{"backend"})
+	// UploadFailures counts failed uploads by storage backend.
+	UploadFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "joiask_storage_upload_failures_total",
+		Help: "Failed uploads by storage backend.",
+	}, []string{"backend"})
+
+	// DBErrors counts failed database operations by operation.
+	DBErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "joiask_db_errors_total",
+		Help: "Failed database operations by operation.",
+	}, []string{"operation"})
+)
+
+// streaming routes hold the connection open, their latency is meaningless
+var streaming = map[string]bool{
+	"/api/sse":       true,
+	"/api/ws":        true,
+	"/api/onair/sse": true,
+}
+
+// RegisterClients exposes the number of connected realtime clients by transport.
+func RegisterClients(transport string, count func() float64) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "joiask_realtime_clients",
+		Help:        "Connected realtime clients by transport.",
+		ConstLabels: prometheus.Labels{"transport": transport},
+	}, count)
+}
+
+// Middleware records the count and latency of requests by route.
+func Middleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	requests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	if !streaming[route] {
+		requestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics to requests carrying metrics.token as bearer
+// token or token parameter, it is disabled if no token is configured.
+func Handler() gin.HandlerFunc {
+	h := promhttp.Handler()
+	return func(c *gin.Context) {
+		expected := viper.GetString("metrics.token")
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			token = c.Query("token")
+		}
+		if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			c.AbortWithStatus(404)
+			return
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
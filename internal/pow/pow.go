@@ -0,0 +1,250 @@
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"joiask-backend/internal/logging"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var log = logging.Logger("pow")
+
+var issuer *Issuer
+var once sync.Once
+
+var (
+	ErrMalformed = errors.New("malformed challenge")
+	ErrSignature = errors.New("invalid challenge signature")
+	ErrExpired   = errors.New("challenge expired")
+	ErrReplayed  = errors.New("challenge already used")
+	ErrSolution  = errors.New("invalid solution")
+)
+
+// Challenge is the signed payload handed out to clients.
+type Challenge struct {
+	Salt       string `json:"s"`
+	Difficulty int    `json:"d"`
+	ExpiresAt  int64  `json:"e"`
+}
+
+// Issuer issues and verifies proof-of-work challenges. A solution is a nonce
+// such that sha256(token + nonce) has at least Difficulty leading zero bits.
+type Issuer struct {
+	secret        []byte
+	ttl           time.Duration
+	minDifficulty int
+	maxDifficulty int
+	step          int
+
+	mutex       sync.Mutex
+	used        map[string]time.Time
+	submissions []time.Time
+}
+
+// MaxAllowedDifficulty caps the difficulty, each bit doubles the work and 20
+// bits take a browser about two seconds on average.
+const MaxAllowedDifficulty = 20
+
+type IssuerConfig struct {
+	Secret        string
+	TTL           time.Duration
+	MinDifficulty int
+	MaxDifficulty int
+	// Step is the number of submissions per minute that adds one bit of difficulty.
+	Step int
+}
+
+func New(c IssuerConfig) *Issuer {
+	secret := []byte(c.Secret)
+	if len(secret) == 0 {
+		log.Warn("pow.secret is not set, using a random secret; challenges will not survive restarts")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if c.TTL <= 0 {
+		c.TTL = 5 * time.Minute
+	}
+	if c.MinDifficulty <= 0 {
+		c.MinDifficulty = 16
+	}
+	if c.MinDifficulty > MaxAllowedDifficulty {
+		c.MinDifficulty = MaxAllowedDifficulty
+	}
+	if c.MaxDifficulty < c.MinDifficulty {
+		c.MaxDifficulty = c.MinDifficulty + 4
+	}
+	if c.MaxDifficulty > MaxAllowedDifficulty {
+		c.MaxDifficulty = MaxAllowedDifficulty
+	}
+	if c.Step <= 0 {
+		c.Step = 10
+	}
+	return &Issuer{
+		secret:        secret,
+		ttl:           c.TTL,
+		minDifficulty: c.MinDifficulty,
+		maxDifficulty: c.MaxDifficulty,
+		step:          c.Step,
+		used:          make(map[string]time.Time),
+	}
+}
+
+// Get the single issuer instance
+func Get() *Issuer {
+	once.Do(func() {
+		issuer = New(IssuerConfig{
+			Secret:        viper.GetString("pow.secret"),
+			TTL:           time.Duration(viper.GetInt("pow.ttl")) * time.Second,
+			MinDifficulty: viper.GetInt("pow.min_difficulty"),
+			MaxDifficulty: viper.GetInt("pow.max_difficulty"),
+			Step:          viper.GetInt("pow.step"),
+		})
+	})
+	return issuer
+}
+
+// Difficulty returns the difficulty for new challenges based on the number of
+// submissions recorded during the last minute.
+func (i *Issuer) Difficulty() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.pruneSubmissions(time.Now())
+	d := i.minDifficulty + len(i.submissions)/i.step
+	if d > i.maxDifficulty {
+		d = i.maxDifficulty
+	}
+	return d
+}
+
+// Issue creates a new signed challenge token.
+func (i *Issuer) Issue() (string, Challenge, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", Challenge{}, err
+	}
+	challenge := Challenge{
+		Salt:       hex.EncodeToString(salt),
+		Difficulty: i.Difficulty(),
+		ExpiresAt:  time.Now().Add(i.ttl).Unix(),
+	}
+	payload, err := json.Marshal(challenge)
+	if err != nil {
+		return "", Challenge{}, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + i.sign(encoded), challenge, nil
+}
+
+// Verify checks the token signature, expiry and solution. Verify does not use
+// up the token, call Redeem once the submission is stored.
+func (i *Issuer) Verify(token string, nonce string) error {
+	challenge, err := i.parse(token)
+	if err != nil {
+		return err
+	}
+	if time.Now().After(time.Unix(challenge.ExpiresAt, 0)) {
+		return ErrExpired
+	}
+	if len(nonce) == 0 || len(nonce) > 64 {
+		return ErrSolution
+	}
+	sum := sha256.Sum256([]byte(token + nonce))
+	if leadingZeroBits(sum[:]) < challenge.Difficulty {
+		return ErrSolution
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if _, ok := i.used[challenge.Salt]; ok {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// Redeem marks a verified token as used, a token can only be redeemed once.
+func (i *Issuer) Redeem(token string) error {
+	challenge, err := i.parse(token)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for salt, expiry := range i.used {
+		if now.After(expiry) {
+			delete(i.used, salt)
+		}
+	}
+	if _, ok := i.used[challenge.Salt]; ok {
+		return ErrReplayed
+	}
+	i.used[challenge.Salt] = time.Unix(challenge.ExpiresAt, 0)
+	return nil
+}
+
+// parse checks the token signature and decodes the challenge.
+func (i *Issuer) parse(token string) (Challenge, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Challenge{}, ErrMalformed
+	}
+	if !hmac.Equal([]byte(signature), []byte(i.sign(encoded))) {
+		return Challenge{}, ErrSignature
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Challenge{}, ErrMalformed
+	}
+	var challenge Challenge
+	if err := json.Unmarshal(payload, &challenge); err != nil {
+		return Challenge{}, ErrMalformed
+	}
+	return challenge, nil
+}
+
+// Record counts an accepted submission for difficulty adaptation.
+func (i *Issuer) Record() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	now := time.Now()
+	i.pruneSubmissions(now)
+	i.submissions = append(i.submissions, now)
+}
+
+func (i *Issuer) pruneSubmissions(now time.Time) {
+	cutoff := now.Add(-time.Minute)
+	n := 0
+	for n < len(i.submissions) && i.submissions[n].Before(cutoff) {
+		n++
+	}
+	i.submissions = i.submissions[n:]
+}
+
+func (i *Issuer) sign(v string) string {
+	m := hmac.New(sha256.New, i.secret)
+	m.Write([]byte(v))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, v := range b {
+		if v == 0 {
+			n += 8
+			continue
+		}
+		return n + bits.LeadingZeros8(v)
+	}
+	return n
+}
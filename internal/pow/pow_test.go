@@ -0,0 +1,163 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want int
+	}{
+		{"empty", nil, 0},
+		{"high bit set", []byte{0x80, 0x00}, 0},
+		{"one zero bit", []byte{0x40}, 1},
+		{"seven zero bits", []byte{0x01}, 7},
+		{"zero byte then high bit", []byte{0x00, 0x80}, 8},
+		{"zero byte then low bit", []byte{0x00, 0x01}, 15},
+		{"all zero", []byte{0x00, 0x00, 0x00}, 24},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := leadingZeroBits(tt.in); got != tt.want {
+				t.Errorf("leadingZeroBits(%x) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// solve finds a nonce for token by brute force, difficulties in the tests are
+// small enough for this to be instant.
+func solve(t *testing.T, token string, difficulty int) string {
+	t.Helper()
+	for i := 0; ; i++ {
+		nonce := strconv.FormatInt(int64(i), 36)
+		sum := sha256.Sum256([]byte(token + nonce))
+		if leadingZeroBits(sum[:]) >= difficulty {
+			return nonce
+		}
+	}
+}
+
+// wrongNonce returns a nonce that does not solve token.
+func wrongNonce(t *testing.T, token string, difficulty int) string {
+	t.Helper()
+	for i := 0; ; i++ {
+		nonce := strconv.FormatInt(int64(i), 36)
+		sum := sha256.Sum256([]byte(token + nonce))
+		if leadingZeroBits(sum[:]) < difficulty {
+			return nonce
+		}
+	}
+}
+
+// sign returns a validly signed token for challenge.
+func sign(t *testing.T, i *Issuer, challenge Challenge) string {
+	t.Helper()
+	payload, err := json.Marshal(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + i.sign(encoded)
+}
+
+func TestVerify(t *testing.T) {
+	issuer := New(IssuerConfig{Secret: "secret", MinDifficulty: 8, MaxDifficulty: 8})
+	other := New(IssuerConfig{Secret: "other", MinDifficulty: 8, MaxDifficulty: 8})
+	token, challenge, err := issuer.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge.Difficulty != 8 {
+		t.Fatalf("difficulty = %d, want 8", challenge.Difficulty)
+	}
+	otherToken, _, err := other.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := sign(t, issuer, Challenge{Salt: "expired", Difficulty: 8, ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	tampered := sign(t, issuer, Challenge{Salt: "tampered", Difficulty: 0, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	tampered = "x" + tampered
+
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+		want  error
+	}{
+		{"valid", token, solve(t, token, 8), nil},
+		{"wrong nonce", token, wrongNonce(t, token, 8), ErrSolution},
+		{"empty nonce", token, "", ErrSolution},
+		{"long nonce", token, string(make([]byte, 65)), ErrSolution},
+		{"no signature", "payload", "0", ErrMalformed},
+		{"signed by another issuer", otherToken, solve(t, otherToken, 8), ErrSignature},
+		{"tampered payload", tampered, "0", ErrSignature},
+		{"expired", expired, solve(t, expired, 8), ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := issuer.Verify(tt.token, tt.nonce); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedeem(t *testing.T) {
+	issuer := New(IssuerConfig{Secret: "secret", MinDifficulty: 4, MaxDifficulty: 4})
+	token, _, err := issuer.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := solve(t, token, 4)
+
+	// Verifying does not use up the token
+	for i := 0; i < 2; i++ {
+		if err := issuer.Verify(token, nonce); err != nil {
+			t.Fatalf("Verify() #%d = %v, want nil", i, err)
+		}
+	}
+	if err := issuer.Redeem(token); err != nil {
+		t.Fatalf("Redeem() = %v, want nil", err)
+	}
+	if err := issuer.Verify(token, nonce); !errors.Is(err, ErrReplayed) {
+		t.Errorf("Verify() after Redeem = %v, want %v", err, ErrReplayed)
+	}
+	if err := issuer.Redeem(token); !errors.Is(err, ErrReplayed) {
+		t.Errorf("second Redeem() = %v, want %v", err, ErrReplayed)
+	}
+	if err := issuer.Redeem("payload.signature"); !errors.Is(err, ErrSignature) {
+		t.Errorf("Redeem() of forged token = %v, want %v", err, ErrSignature)
+	}
+}
+
+func TestNewCapsDifficulty(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max int
+		wantMin  int
+		wantMax  int
+	}{
+		{"defaults", 0, 0, 16, MaxAllowedDifficulty},
+		{"within cap", 10, 12, 10, 12},
+		{"max above cap", 10, 30, 10, MaxAllowedDifficulty},
+		{"both above cap", 25, 30, MaxAllowedDifficulty, MaxAllowedDifficulty},
+		{"max below min", 12, 4, 12, 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := New(IssuerConfig{Secret: "secret", MinDifficulty: tt.min, MaxDifficulty: tt.max})
+			if i.minDifficulty != tt.wantMin || i.maxDifficulty != tt.wantMax {
+				t.Errorf("difficulty = [%d, %d], want [%d, %d]", i.minDifficulty, i.maxDifficulty, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
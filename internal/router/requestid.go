@@ -0,0 +1,66 @@
+package router
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"joiask-backend/internal/controller"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID accepts ids of up to 128 printable characters without
+// spaces, so a client id can not forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestID gives every request an id, keeping a valid incoming X-Request-ID,
+// and echoes it in the response.
+func requestID(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	c.Set(controller.RequestIDKey, id)
+	c.Header(requestIDHeader, id)
+	c.Next()
+}
+
+// accessLog logs every request with its id once it is handled.
+func accessLog(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	entry := log.WithFields(logrus.Fields{
+		"request_id": c.GetString(controller.RequestIDKey),
+		"method":     c.Request.Method,
+		"path":       c.Request.URL.Path,
+		"status":     c.Writer.Status(),
+		"latency_ms": time.Since(start).Milliseconds(),
+		"client_ip":  c.ClientIP(),
+	})
+	if c.Writer.Status() >= 500 {
+		entry.Error("request failed")
+		return
+	}
+	entry.Info("request handled")
+}
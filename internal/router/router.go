@@ -1,41 +1,70 @@
 package router
 
 import (
+	"context"
 	"joiask-backend/internal/controller"
+	"joiask-backend/internal/database"
+	"joiask-backend/internal/logging"
+	"joiask-backend/internal/metrics"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+var log = logging.Logger("router")
+
 func Run() {
-	r := gin.Default()
+	r := gin.New()
 	r.MaxMultipartMemory = 30 << 20 // 30 MB
+	r.Use(requestID)
+	r.Use(accessLog)
 	r.Use(gin.Recovery())
+	r.Use(metrics.Middleware)
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:3001", "*"},
 		AllowCredentials: true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", requestIDHeader},
+		ExposeHeaders:    []string{requestIDHeader},
 	}))
-	store := cookie.NewStore([]byte("WhyJoiIsSoCute"))
+	secret := viper.GetString("session.secret")
+	if secret == "" {
+		log.Warn("session.secret is not set, using the built-in secret; anyone can forge admin sessions")
+		secret = "WhyJoiIsSoCute"
+	}
+	store := cookie.NewStore([]byte(secret))
 	store.Options(sessions.Options{
 		Path:     "/",
 		Secure:   false,
 		SameSite: http.SameSiteLaxMode,
 	})
 	r.Use(sessions.Sessions("session", store))
+	r.GET("/metrics", metrics.Handler())
 	api := r.Group("/api")
-	tagController := new(controller.TagController)
 	userController := new(controller.UserController)
 	questionController := controller.NewQuestionController()
+	tagController := controller.NewTagController(questionController)
 	configController := new(controller.ConfigController)
 	statisticsController := new(controller.StatisticsController)
+	challengeController := new(controller.ChallengeController)
+	banController := new(controller.BanController)
+	shadowController := new(controller.ShadowController)
+	emojiController := new(controller.EmojiController)
+	onAirController := new(controller.OnAirController)
+	sessionController := new(controller.SessionController)
+	auditController := new(controller.AuditController)
+	healthController := new(controller.HealthController)
+	r.GET("/healthz", healthController.Healthz)
+	r.GET("/readyz", healthController.Readyz)
 	{
 		// User
 		{
@@ -54,28 +83,110 @@ func Run() {
 			api.PUT("/tag/:id", authMiddleware, tagController.Put)
 			api.DELETE("/tag/:id", authMiddleware, tagController.Delete)
 			api.POST("/tag", authMiddleware, tagController.Post)
+			api.POST("/tag/:id/cover", authMiddleware, tagController.PostCover)
+			api.POST("/tag/:id/merge", authMiddleware, tagController.Merge)
+			api.DELETE("/tag/:id/cover", authMiddleware, tagController.DeleteCover)
 		}
 		// Question
 		{
+			api.GET("/challenge", challengeController.Get)
 			api.GET("/question", questionController.Get)
+			api.GET("/question/trending", questionController.Trending)
+			api.POST("/question/draw", authMiddleware, questionController.Draw)
+			api.DELETE("/question/draw", authMiddleware, questionController.ResetDraw)
+			api.GET("/question/:id", questionController.GetOne)
 			api.POST("/question", questionController.Post)
 			api.PUT("/question/:id", authMiddleware, questionController.Put)
 			api.POST("/question/:id/emoji", questionController.Emoji)
 			api.GET("/sse", questionController.SSE)
 			api.GET("/ws", questionController.WebSocket)
 			api.DELETE("/question/:id", authMiddleware, questionController.Delete)
+			api.POST("/question/:id/ban", authMiddleware, banController.BanSubmitter)
+		}
+		// Ban
+		{
+			api.GET("/ban", authMiddleware, banController.Get)
+			api.POST("/ban", authMiddleware, banController.Post)
+			api.DELETE("/ban/:id", authMiddleware, banController.Delete)
+		}
+		// Shadow ban
+		{
+			api.GET("/shadowban", authMiddleware, shadowController.Get)
+			api.POST("/question/:id/shadowban", authMiddleware, shadowController.Post)
+			api.DELETE("/shadowban/:id", authMiddleware, shadowController.Delete)
+			api.POST("/question/:id/restore", authMiddleware, shadowController.Restore)
+			api.DELETE("/shadow", authMiddleware, shadowController.Purge)
+		}
+		// Emoji
+		{
+			api.GET("/emoji", emojiController.Get)
+			api.POST("/emoji", authMiddleware, emojiController.Post)
+			api.PUT("/emoji/:id", authMiddleware, emojiController.Put)
+			api.DELETE("/emoji/:id", authMiddleware, emojiController.Delete)
+		}
+		// Session
+		{
+			api.GET("/session", sessionController.Get)
+			api.POST("/session", authMiddleware, sessionController.Post)
+			api.PUT("/session/:id", authMiddleware, sessionController.Put)
+			api.DELETE("/session/:id", authMiddleware, sessionController.Delete)
+		}
+		// On air
+		{
+			api.GET("/onair", onAirController.Get)
+			api.GET("/onair/sse", onAirController.SSE)
+			api.PUT("/onair", authMiddleware, onAirController.Put)
+			api.DELETE("/onair", authMiddleware, onAirController.Delete)
 		}
 		// Config
 		{
 			api.GET("/config", configController.Get)
 			api.PUT("/config", authMiddleware, configController.Put)
 		}
+		// Audit
+		{
+			api.GET("/audit", authMiddleware, auditController.Get)
+		}
 		// Statistics
 		{
 			api.GET("/statistics", authMiddleware, statisticsController.Get)
+			api.GET("/statistics/series", authMiddleware, statisticsController.Series)
 		}
 	}
 	address := viper.GetString("server.host") + ":" + strconv.Itoa(viper.GetInt("server.port"))
-	logrus.Info(address)
-	logrus.Error(r.Run(address))
+	log.Info(address)
+	srv := &http.Server{Addr: address, Handler: r}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		log.Error(err)
+		return
+	case sig := <-quit:
+		log.Infof("Received %s, shutting down", sig)
+	}
+	signal.Stop(quit)
+
+	// Realtime clients never finish on their own, so they are disconnected
+	// first and in-flight requests are then given time to finish
+	questionController.Shutdown()
+	onAirController.Shutdown()
+	timeout := time.Duration(viper.GetInt("server.shutdown_timeout")) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Error("Failed to drain requests: ", err)
+	}
+	if err := database.Close(); err != nil {
+		log.Error("Failed to close database: ", err)
+	}
+	log.Info("Server stopped")
 }
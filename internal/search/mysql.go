@@ -0,0 +1,55 @@
+package search
+
+import (
+	"strings"
+
+	"joiask-backend/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// MySQL searches with a FULLTEXT index using the ngram parser, which is
+// maintained by InnoDB on every write.
+type MySQL struct{}
+
+const fulltextIndex = "idx_questions_content_fulltext"
+
+// ngramLength is the default ngram_token_size, shorter terms can not match.
+const ngramLength = 2
+
+func (*MySQL) Init() error {
+	var count int64
+	err := database.DB.Raw("SELECT count(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'questions' AND index_name = ?", fulltextIndex).Scan(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	log.Info("Building full-text search index.")
+	return database.DB.Exec("ALTER TABLE questions ADD FULLTEXT INDEX " + fulltextIndex + " (content) WITH PARSER ngram").Error
+}
+
+// booleanQuery requires every term as a phrase, so user input is never parsed
+// as boolean search operators.
+func booleanQuery(terms []string) string {
+	quoted := make([]string, 0, len(terms))
+	for _, t := range terms {
+		quoted = append(quoted, `+"`+strings.ReplaceAll(t, `"`, " ")+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (*MySQL) Match(tx *gorm.DB, query string) (*gorm.DB, string) {
+	t := terms(query)
+	if len(t) == 0 || minTermLength(t) < ngramLength {
+		return (&Like{}).Match(tx, query)
+	}
+	q := booleanQuery(t)
+	tx = tx.Joins("JOIN (SELECT id AS fts_id, MATCH(content) AGAINST(? IN BOOLEAN MODE) AS fts_rank FROM questions WHERE MATCH(content) AGAINST(? IN BOOLEAN MODE)) AS fts ON fts.fts_id = questions.id", q, q)
+	return tx, "fts.fts_rank desc"
+}
+
+func (*MySQL) Snippets(query string, ids []uint) (map[uint]string, error) {
+	return contentSnippets(query, ids)
+}
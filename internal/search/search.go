@@ -0,0 +1,179 @@
+package search
+
+import (
+	"html"
+	"joiask-backend/internal/logging"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"joiask-backend/internal/database"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+var log = logging.Logger("search")
+
+var engine Engine
+var once sync.Once
+
+// Engine searches question content.
+type Engine interface {
+	// Init creates or updates the index, an error means the engine can not be used.
+	Init() error
+	// Match restricts tx to questions matching query. It returns the order clause
+	// that sorts by relevance, which is empty if the results are not ranked.
+	Match(tx *gorm.DB, query string) (*gorm.DB, string)
+	// Snippets returns highlighted snippets for the matched questions.
+	Snippets(query string, ids []uint) (map[uint]string, error)
+}
+
+// Markers around matched text in the raw snippet, replaced after escaping.
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// snippetWidth is the approximate number of characters in a snippet.
+const snippetWidth = 48
+
+// Init chooses the search engine by db_type and builds its index, falling back
+// to substring search if the database does not support full-text search.
+func Init() {
+	once.Do(func() {
+		switch viper.GetString("db_type") {
+		case "sqlite":
+			engine = &SQLite{}
+		case "mysql":
+			engine = &MySQL{}
+		default:
+			engine = &Like{}
+		}
+		if err := engine.Init(); err != nil {
+			log.Warn("Full-text search is unavailable, falling back to substring search: ", err)
+			engine = &Like{}
+		}
+	})
+}
+
+// Get the single search engine instance
+func Get() Engine {
+	Init()
+	return engine
+}
+
+// terms splits a search query into its whitespace separated terms.
+func terms(query string) []string {
+	return strings.Fields(query)
+}
+
+// minTermLength returns the length in characters of the shortest term.
+func minTermLength(terms []string) int {
+	n := -1
+	for _, t := range terms {
+		if l := utf8.RuneCountInString(t); n < 0 || l < n {
+			n = l
+		}
+	}
+	return n
+}
+
+// render escapes a raw snippet and turns the markers into <mark> tags.
+func render(raw string) string {
+	escaped := html.EscapeString(raw)
+	escaped = strings.ReplaceAll(escaped, markStart, "<mark>")
+	return strings.ReplaceAll(escaped, markEnd, "</mark>")
+}
+
+// highlight builds a snippet of content around the first matched term.
+func highlight(content string, terms []string) string {
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	type span struct{ start, end int }
+	var spans []span
+	for _, t := range terms {
+		needle := []rune(strings.ToLower(t))
+		if len(needle) == 0 {
+			continue
+		}
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if string(lower[i:i+len(needle)]) == string(needle) {
+				spans = append(spans, span{i, i + len(needle)})
+				i += len(needle) - 1
+			}
+		}
+	}
+	first := len(runes)
+	for _, s := range spans {
+		if s.start < first {
+			first = s.start
+		}
+	}
+	if first == len(runes) {
+		first = 0
+	}
+	from := first - snippetWidth/4
+	if from < 0 {
+		from = 0
+	}
+	to := from + snippetWidth
+	if to > len(runes) {
+		to = len(runes)
+	}
+	marked := make([]bool, len(runes))
+	for _, s := range spans {
+		for i := s.start; i < s.end && i < len(marked); i++ {
+			marked[i] = true
+		}
+	}
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	for i := from; i < to; i++ {
+		if marked[i] && (i == from || !marked[i-1]) {
+			b.WriteString(markStart)
+		}
+		b.WriteRune(runes[i])
+		if marked[i] && (i == to-1 || !marked[i+1]) {
+			b.WriteString(markEnd)
+		}
+	}
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return render(b.String())
+}
+
+// Like is the substring search used when full-text search is unavailable.
+type Like struct{}
+
+func (*Like) Init() error {
+	return nil
+}
+
+func (*Like) Match(tx *gorm.DB, query string) (*gorm.DB, string) {
+	for _, t := range terms(query) {
+		tx = tx.Where("content like ?", "%"+t+"%")
+	}
+	return tx, ""
+}
+
+func (*Like) Snippets(query string, ids []uint) (map[uint]string, error) {
+	return contentSnippets(query, ids)
+}
+
+// contentSnippets loads the content of the questions and highlights it in Go.
+func contentSnippets(query string, ids []uint) (map[uint]string, error) {
+	var questions []database.Question
+	if err := database.DB.Select("id, content").Where("id in ?", ids).Find(&questions).Error; err != nil {
+		return nil, err
+	}
+	t := terms(query)
+	snippets := make(map[uint]string, len(questions))
+	for _, q := range questions {
+		snippets[q.ID] = highlight(q.Content, t)
+	}
+	return snippets, nil
+}
@@ -0,0 +1,108 @@
+package search
+
+import (
+	"errors"
+	"strings"
+
+	"joiask-backend/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// SQLite searches with an FTS5 table using the trigram tokenizer, which also
+// works for Chinese text without word boundaries. FTS5 requires the binary to
+// be built with the sqlite_fts5 tag. The index is kept in sync by triggers.
+type SQLite struct{}
+
+// trigramLength is the shortest term the trigram tokenizer can match.
+const trigramLength = 3
+
+// ftsTriggers are the triggers keeping questions_fts in sync with questions.
+var ftsTriggers = []string{"questions_fts_ai", "questions_fts_ad", "questions_fts_au"}
+
+func (*SQLite) Init() error {
+	var enabled bool
+	if err := database.DB.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error; err != nil {
+		return err
+	}
+	if !enabled {
+		// Triggers left by a build with FTS5 would fail every write of questions
+		for _, name := range ftsTriggers {
+			if err := database.DB.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				return err
+			}
+		}
+		return errors.New("sqlite is built without FTS5, build with -tags sqlite_fts5 to enable full-text search")
+	}
+	// The index misses writes made while the triggers did not exist
+	var count int64
+	err := database.DB.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'trigger' AND name IN ?", ftsTriggers).Scan(&count).Error
+	if err != nil {
+		return err
+	}
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS questions_fts USING fts5(content, content='questions', content_rowid='id', tokenize='trigram')`,
+		`CREATE TRIGGER IF NOT EXISTS questions_fts_ai AFTER INSERT ON questions BEGIN
+			INSERT INTO questions_fts(rowid, content) VALUES (new.id, new.content);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS questions_fts_ad AFTER DELETE ON questions BEGIN
+			INSERT INTO questions_fts(questions_fts, rowid, content) VALUES ('delete', old.id, old.content);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS questions_fts_au AFTER UPDATE OF content ON questions BEGIN
+			INSERT INTO questions_fts(questions_fts, rowid, content) VALUES ('delete', old.id, old.content);
+			INSERT INTO questions_fts(rowid, content) VALUES (new.id, new.content);
+		END`,
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, s := range statements {
+			if err := tx.Exec(s).Error; err != nil {
+				return err
+			}
+		}
+		if count < int64(len(ftsTriggers)) {
+			log.Info("Building full-text search index.")
+			return tx.Exec("INSERT INTO questions_fts(questions_fts) VALUES ('rebuild')").Error
+		}
+		return nil
+	})
+}
+
+// matchQuery quotes every term so user input is never parsed as FTS5 syntax.
+func matchQuery(terms []string) string {
+	quoted := make([]string, 0, len(terms))
+	for _, t := range terms {
+		quoted = append(quoted, `"`+strings.ReplaceAll(t, `"`, `""`)+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (*SQLite) Match(tx *gorm.DB, query string) (*gorm.DB, string) {
+	t := terms(query)
+	if len(t) == 0 || minTermLength(t) < trigramLength {
+		return (&Like{}).Match(tx, query)
+	}
+	tx = tx.Joins("JOIN (SELECT rowid AS fts_id, rank AS fts_rank FROM questions_fts WHERE questions_fts MATCH ?) AS fts ON fts.fts_id = questions.id", matchQuery(t))
+	// rank is bm25, lower is more relevant
+	return tx, "fts.fts_rank asc"
+}
+
+func (*SQLite) Snippets(query string, ids []uint) (map[uint]string, error) {
+	t := terms(query)
+	if len(t) == 0 || minTermLength(t) < trigramLength {
+		return contentSnippets(query, ids)
+	}
+	var rows []struct {
+		ID      uint
+		Snippet string
+	}
+	err := database.DB.Raw("SELECT rowid AS id, snippet(questions_fts, 0, ?, ?, '…', 32) AS snippet FROM questions_fts WHERE questions_fts MATCH ? AND rowid IN ?",
+		markStart, markEnd, matchQuery(t), ids).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	snippets := make(map[uint]string, len(rows))
+	for _, r := range rows {
+		snippets[r.ID] = render(r.Snippet)
+	}
+	return snippets, nil
+}
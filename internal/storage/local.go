@@ -4,8 +4,6 @@ import (
 	"bytes"
 	"io"
 	"os"
-
-	"github.com/sirupsen/logrus"
 )
 
 type Local struct {
@@ -24,11 +22,16 @@ func (l *Local) Upload(filename string, content *bytes.Reader) (string, error) {
 }
 
 func (l *Local) Delete(filename string) error {
-	err := os.Remove("frontend/public/upload-img/" + filename)
-	if err != nil {
-		logrus.Error("remove file failed: ", err)
+	return os.Remove("frontend/public/upload-img/" + filename)
+}
+
+// Check writes and removes a test file in the upload directory
+func (l *Local) Check() error {
+	name := "frontend/public/upload-img/.healthcheck"
+	if err := os.WriteFile(name, []byte("ok"), 0644); err != nil {
+		return err
 	}
-	return err
+	return os.Remove(name)
 }
 
 func NewLocal() *Local {
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"bytes"
+
+	"joiask-backend/internal/metrics"
+)
+
+// instrumented records upload metrics of a storage backend.
+type instrumented struct {
+	Storage
+	backend string
+}
+
+func (s *instrumented) Upload(filename string, content *bytes.Reader) (string, error) {
+	size := content.Len()
+	url, err := s.Storage.Upload(filename, content)
+	if err != nil {
+		metrics.UploadFailures.WithLabelValues(s.backend).Inc()
+		return url, err
+	}
+	metrics.UploadBytes.WithLabelValues(s.backend).Add(float64(size))
+	return url, nil
+}
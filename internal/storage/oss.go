@@ -4,7 +4,6 @@ import (
 	"bytes"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
-	"github.com/sirupsen/logrus"
 )
 
 type OSS struct {
@@ -17,12 +16,12 @@ func NewOSS(address string, endpoint string, accessKey string, secretKey string,
 	var err error
 	ossClient, err := oss.New(endpoint, accessKey, secretKey)
 	if err != nil {
-		logrus.Fatal(err)
+		log.Fatal(err)
 	}
 	// 获取存储空间。
 	ossBucket, err := ossClient.Bucket(bucket)
 	if err != nil {
-		logrus.Fatal(err)
+		log.Fatal(err)
 	}
 	return &OSS{
 		address, ossClient, ossBucket,
@@ -32,16 +31,17 @@ func NewOSS(address string, endpoint string, accessKey string, secretKey string,
 func (s *OSS) Upload(filename string, content *bytes.Reader) (string, error) {
 	err := s.bucket.PutObject("upload-img/"+filename, content)
 	if err != nil {
-		logrus.Error(err)
 		return "", err
 	}
 	return s.address + "/upload-img/" + filename, nil
 }
 
 func (s *OSS) Delete(filename string) error {
-	err := s.bucket.DeleteObject("upload-img/" + filename)
-	if err != nil {
-		logrus.Error("OSS delete file failed: ", err)
-	}
+	return s.bucket.DeleteObject("upload-img/" + filename)
+}
+
+// Check reads the bucket info, which fails on wrong credentials or bucket
+func (s *OSS) Check() error {
+	_, err := s.client.GetBucketInfo(s.bucket.BucketName)
 	return err
 }
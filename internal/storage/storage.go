@@ -2,17 +2,23 @@ package storage
 
 import (
 	"bytes"
+	"fmt"
+	"joiask-backend/internal/logging"
 	"sync"
 
 	"github.com/spf13/viper"
 )
 
+var log = logging.Logger("storage")
+
 var storage Storage
 var once sync.Once
 
 type Storage interface {
 	Upload(filename string, content *bytes.Reader) (string, error)
 	Delete(filename string) error
+	// Check verifies the backend can be reached with the configured credentials
+	Check() error
 }
 
 const (
@@ -20,14 +26,14 @@ const (
 	TYPE_OSS
 )
 
-func StrToType(s string) int {
+func StrToType(s string) (int, error) {
 	switch s {
 	case "local":
-		return TYPE_LOCAL
+		return TYPE_LOCAL, nil
 	case "oss":
-		return TYPE_OSS
+		return TYPE_OSS, nil
 	}
-	panic("Invalid storage type")
+	return 0, fmt.Errorf("invalid storage type %q", s)
 }
 
 type StorageConfig struct {
@@ -52,15 +58,23 @@ func New(s StorageConfig) Storage {
 // Get the single storage instance
 func Get() Storage {
 	once.Do(func() {
+		storageType, err := StrToType(viper.GetString("storage_type"))
+		if err != nil {
+			// The config is validated at startup, so this is a programming error
+			log.Fatal(err)
+		}
 		storeConfig := StorageConfig{
-			StorageType: StrToType(viper.GetString("storage_type")),
+			StorageType: storageType,
 			Address:     viper.GetString("oss.address"),
 			Endpoint:    viper.GetString("oss.endpoint"),
 			AccessKey:   viper.GetString("oss.access_key"),
 			SecretKey:   viper.GetString("oss.secret_key"),
 			Bucket:      viper.GetString("oss.bucket"),
 		}
-		storage = New(storeConfig)
+		storage = &instrumented{
+			Storage: New(storeConfig),
+			backend: viper.GetString("storage_type"),
+		}
 	})
 	return storage
 }
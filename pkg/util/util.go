@@ -1,7 +1,9 @@
 package util
 
 import (
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
@@ -11,3 +13,9 @@ func Md5v(v string) string {
 	m.Write(d)
 	return hex.EncodeToString(m.Sum(nil))
 }
+
+func HmacSha256(key string, v string) string {
+	m := hmac.New(sha256.New, []byte(key))
+	m.Write([]byte(v))
+	return hex.EncodeToString(m.Sum(nil))
+}
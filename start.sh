@@ -1,10 +1,22 @@
 #!/bin/bash
 
-# Start the Go backend
+# Start the Go backend, built with: go build -tags sqlite_fts5 -o jask ./cmd
 ./jask &
+JASK_PID=$!
 
 # Start Nginx
 nginx -g 'daemon off;' &
+NGINX_PID=$!
+
+# Let the backend drain its requests before Nginx stops proxying
+shutdown() {
+    kill -TERM "$JASK_PID" 2>/dev/null
+    wait "$JASK_PID"
+    kill -QUIT "$NGINX_PID" 2>/dev/null
+    wait "$NGINX_PID"
+    exit 0
+}
+trap shutdown TERM INT
 
 # Wait for all background processes
 wait